@@ -0,0 +1,290 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hifx/bingo/infra/metrics"
+)
+
+// ErrCircuitOpen is returned for requests to a host whose circuit breaker is open
+var ErrCircuitOpen = errors.New("client: circuit breaker open")
+
+// ErrBulkheadFull is returned for requests to a host with too many requests in flight
+var ErrBulkheadFull = errors.New("client: too many concurrent requests")
+
+// BreakerOptions configures the per-host circuit breakers
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures opening the breaker. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is the time the breaker stays open before letting probes through. Defaults to 30s.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent probes allowed while half-open. Defaults to 1.
+	HalfOpenProbes int
+	// Failure decides whether a response counts as a failure. Defaults to transport errors and 5xx responses.
+	Failure func(resp *http.Response, err error) bool
+}
+
+// BulkheadOptions configures the per-host limits of concurrent requests
+type BulkheadOptions struct {
+	// MaxConcurrent is the number of requests in flight allowed per host. A request is in
+	// flight until its response body is read to the end or closed.
+	MaxConcurrent int
+	// MaxWait is the time a request waits for a slot before failing with ErrBulkheadFull
+	MaxWait time.Duration
+}
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+var (
+	transitions = metrics.NewCounter("http_client_breaker_transitions_total")
+	rejections  = metrics.NewCounter("http_client_rejected_total")
+)
+
+// breaker is the circuit breaker of a host
+type breaker struct {
+	host string
+	o    BreakerOptions
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// allow reports whether a request may go through, and whether it is a probe of a half-open
+// breaker. Requests allowed must be followed by a call to done.
+func (b *breaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.o.OpenTimeout {
+			return false, false
+		}
+		b.transition(stateHalfOpen)
+		fallthrough
+	case stateHalfOpen:
+		if b.probes >= b.o.HalfOpenProbes {
+			return false, false
+		}
+		b.probes++
+		return true, true
+	}
+	return true, false
+}
+
+// done records the outcome of a request allowed by allow
+func (b *breaker) done(probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		if b.state != stateHalfOpen {
+			return
+		}
+		b.probes--
+		if failed {
+			b.transition(stateOpen)
+		} else {
+			b.transition(stateClosed)
+		}
+		return
+	}
+	// outcomes of requests allowed before the breaker opened are ignored
+	if b.state != stateClosed {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.o.FailureThreshold {
+		b.transition(stateOpen)
+	}
+}
+
+// abort releases a request allowed by allow without recording its outcome
+func (b *breaker) abort(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe && b.state == stateHalfOpen {
+		b.probes--
+	}
+}
+
+func (b *breaker) transition(to breakerState) {
+	transitions.Inc(metrics.Labels{"host": b.host, "from": b.state.String(), "to": to.String()})
+	b.state = to
+	b.failures = 0
+	b.probes = 0
+	if to == stateOpen {
+		b.openedAt = time.Now()
+	}
+}
+
+// guard is a transport enforcing the circuit breakers and bulkheads of the hosts
+type guard struct {
+	next     http.RoundTripper
+	breaker  *BreakerOptions
+	bulkhead *BulkheadOptions
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	slots    map[string]chan struct{}
+}
+
+func newGuard(next http.RoundTripper, br *BreakerOptions, bh *BulkheadOptions) *guard {
+	if br != nil {
+		o := *br
+		if o.FailureThreshold <= 0 {
+			o.FailureThreshold = 5
+		}
+		if o.OpenTimeout <= 0 {
+			o.OpenTimeout = 30 * time.Second
+		}
+		if o.HalfOpenProbes <= 0 {
+			o.HalfOpenProbes = 1
+		}
+		if o.Failure == nil {
+			o.Failure = func(resp *http.Response, err error) bool {
+				return err != nil || resp.StatusCode >= http.StatusInternalServerError
+			}
+		}
+		br = &o
+	}
+	return &guard{
+		next:     next,
+		breaker:  br,
+		bulkhead: bh,
+		breakers: map[string]*breaker{},
+		slots:    map[string]chan struct{}{},
+	}
+}
+
+func (g *guard) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if g.bulkhead == nil || g.bulkhead.MaxConcurrent <= 0 {
+		return g.roundTrip(req, host)
+	}
+
+	slots := g.slotsOf(host)
+	if err := acquire(req, slots, g.bulkhead.MaxWait); err != nil {
+		rejections.Inc(metrics.Labels{"host": host, "reason": "bulkhead"})
+		return nil, err
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { <-slots }) }
+	resp, err := g.roundTrip(req, host)
+	if err != nil || resp == nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	// the request is in flight until its body is read or closed
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (g *guard) roundTrip(req *http.Request, host string) (*http.Response, error) {
+	if g.breaker == nil {
+		return g.next.RoundTrip(req)
+	}
+
+	b := g.breakerOf(host)
+	ok, probe := b.allow()
+	if !ok {
+		rejections.Inc(metrics.Labels{"host": host, "reason": "breaker"})
+		return nil, ErrCircuitOpen
+	}
+	resp, err := g.next.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// a request canceled by the caller says nothing about the host
+		b.abort(probe)
+	} else {
+		b.done(probe, g.breaker.Failure(resp, err))
+	}
+	return resp, err
+}
+
+// slotBody releases the bulkhead slot of a response once it is read to the end or closed
+type slotBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *slotBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+func acquire(req *http.Request, slots chan struct{}, wait time.Duration) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return ErrBulkheadFull
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrBulkheadFull
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (g *guard) breakerOf(host string) *breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[host]
+	if !ok {
+		b = &breaker{host: host, o: *g.breaker}
+		g.breakers[host] = b
+	}
+	return b
+}
+
+func (g *guard) slotsOf(host string) chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.slots[host]
+	if !ok {
+		s = make(chan struct{}, g.bulkhead.MaxConcurrent)
+		g.slots[host] = s
+	}
+	return s
+}
@@ -0,0 +1,200 @@
+/*
+Package client provides an HTTP client for calls between services. It forwards the
+request ID, the trace context and optionally the caller's token, records per-host
+metrics and logs failed calls with the caller's request ID. It optionally retries
+failed requests, and protects the hosts called with circuit breakers and bulkheads.
+
+e.g. usage
+
+	c := client.New(client.Options{
+		Timeout:      5 * time.Second,
+		ForwardToken: true,
+		Retry:        &client.RetryPolicy{MaxAttempts: 3, Jitter: 0.2},
+		Breaker:      &client.BreakerOptions{FailureThreshold: 10},
+		Bulkhead:     &client.BulkheadOptions{MaxConcurrent: 50, MaxWait: 100 * time.Millisecond},
+	})
+
+	func handler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		req, err := client.NewRequest(ctx, "GET", "http://users/v1/users/42", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.Do(req)
+		...
+	}
+*/
+package client
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/infra/metrics"
+	"github.com/hifx/bingo/infra/trace"
+	"github.com/hifx/bingo/middleware"
+	"github.com/hifx/bingo/middleware/jwt"
+	"golang.org/x/net/context"
+)
+
+// Options configures the client
+type Options struct {
+	// Base is the transport making the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	// Timeout is the timeout of the client, see http.Client
+	Timeout time.Duration
+
+	// ReqIDHeader is the header the request ID is sent in. Defaults to X-Request-Id.
+	ReqIDHeader string
+	// ForwardToken sends the token validated by the jwt middleware as a bearer token,
+	// unless the request already has an Authorization header
+	ForwardToken bool
+	// DeadlineHeader, if set, is the header in which the time left before the deadline of
+	// the context is sent, in milliseconds
+	DeadlineHeader string
+
+	// Retry, if set, retries the failed requests
+	Retry *RetryPolicy
+	// Breaker, if set, stops sending requests to a host that keeps failing, for a while
+	Breaker *BreakerOptions
+	// Bulkhead, if set, limits the requests in flight to a host
+	Bulkhead *BulkheadOptions
+
+	// Logger gets the failed requests if the context holds no logger. The error logger of the service
+	// is a good choice.
+	Logger log.Logger
+}
+
+// New returns an http.Client using a Transport with the given options
+func New(o Options) *http.Client {
+	return &http.Client{Transport: NewTransport(o), Timeout: o.Timeout}
+}
+
+// NewRequest returns a request carrying ctx, so that the transport can forward its values
+func NewRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+var (
+	requests = metrics.NewCounter("http_client_requests_total")
+	latency  = metrics.NewTimer("http_client_request_duration_seconds", nil)
+)
+
+// Transport is an http.RoundTripper forwarding the values of the context of the requests.
+// Every attempt of a request is traced, measured and logged on its own.
+type Transport struct {
+	o     Options
+	retry *RetryPolicy
+}
+
+// NewTransport returns a Transport with the given options
+func NewTransport(o Options) *Transport {
+	if o.Base == nil {
+		o.Base = http.DefaultTransport
+	}
+	if o.ReqIDHeader == "" {
+		o.ReqIDHeader = "X-Request-Id"
+	}
+	if o.Logger == nil {
+		o.Logger = log.Discard
+	}
+	if o.Breaker != nil || o.Bulkhead != nil {
+		o.Base = newGuard(o.Base, o.Breaker, o.Bulkhead)
+	}
+	t := &Transport{o: o}
+	if o.Retry != nil {
+		p := o.Retry.withDefaults()
+		t.retry = &p
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.retry == nil {
+		return t.roundTrip(req)
+	}
+	return roundTripWithRetries(*t.retry, req, t.roundTrip)
+}
+
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+
+	// a RoundTripper must not modify the request
+	out := req.WithContext(ctx)
+	out.Header = make(http.Header, len(req.Header)+3)
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+	if id := middleware.GetReqID(ctx); id != "" {
+		out.Header.Set(t.o.ReqIDHeader, id)
+	}
+	if t.o.ForwardToken && out.Header.Get("Authorization") == "" {
+		if token := jwt.GetToken(ctx); token != "" {
+			out.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && t.o.DeadlineHeader != "" {
+		out.Header.Set(t.o.DeadlineHeader, strconv.FormatInt(int64(time.Until(deadline)/time.Millisecond), 10))
+	}
+
+	ctx, span := trace.StartSpanKind(ctx, req.Method+" "+req.URL.Host, trace.KindClient)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", redactedURL(req))
+	trace.Inject(ctx, out.Header)
+
+	resp, err := t.o.Base.RoundTrip(out)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		span.SetAttribute("http.status_code", code)
+	}
+	labels := metrics.Labels{"host": req.URL.Host, "method": req.Method, "code": code}
+	requests.Inc(labels)
+	latency.ObserveSince(labels, start)
+
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		l := log.FromContext(ctx)
+		if l == log.Discard {
+			l = t.o.Logger.With("req_id", middleware.GetReqID(ctx))
+		}
+		keyvals := []interface{}{
+			"type", "http_client",
+			"host", req.URL.Host,
+			"method", req.Method,
+			"url", redactedURL(req),
+			"latency", time.Since(start).String(),
+		}
+		if err != nil {
+			span.SetError(err)
+			keyvals = append(keyvals, "error", err.Error())
+		} else {
+			span.SetError(statusError(resp.StatusCode))
+			keyvals = append(keyvals, "status", resp.StatusCode)
+		}
+		l.Error(keyvals...)
+	}
+	span.Finish()
+	return resp, err
+}
+
+// redactedURL returns the url of req without its query and credentials, which may hold secrets
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery, u.User, u.Fragment = "", nil, ""
+	return u.String()
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return strconv.Itoa(int(e)) + " " + http.StatusText(int(e))
+}
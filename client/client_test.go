@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hifx/bingo/infra/trace"
+	"github.com/hifx/bingo/middleware"
+	"github.com/hifx/bingo/middleware/jwt"
+	"golang.org/x/net/context"
+)
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	ctx = context.WithValue(ctx, jwt.TOKEN, "t0k3n")
+	ctx, span := trace.StartSpan(ctx, "handler")
+	defer span.Finish()
+
+	c := New(Options{ForwardToken: true})
+	req, _ := NewRequest(ctx, "GET", srv.URL+"/users?email=a@b.com", nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got.Get("X-Request-Id") != "req-1" {
+		t.Error("Request ID: Expected:", "req-1", "Got:", got.Get("X-Request-Id"))
+	}
+	if got.Get("Authorization") != "Bearer t0k3n" {
+		t.Error("Authorization: Expected:", "Bearer t0k3n", "Got:", got.Get("Authorization"))
+	}
+	sc, ok := trace.Extract(got)
+	if !ok || sc.TraceID != span.Context().TraceID || sc.SpanID == span.Context().SpanID {
+		t.Error("Traceparent: Expected a child of", span.Context(), "Got:", got.Get("traceparent"))
+	}
+	if len(req.Header) != 0 {
+		t.Error("The request was modified:", req.Header)
+	}
+}
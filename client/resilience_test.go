@@ -0,0 +1,128 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c := New(Options{Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}})
+	req, _ := NewRequest(context.Background(), "PUT", srv.URL, strings.NewReader("body"))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Error("Expected success after 3 calls, Got:", resp.StatusCode, calls)
+	}
+
+	// POST without an Idempotency-Key isn't retried
+	atomic.StoreInt32(&calls, 0)
+	req, _ = NewRequest(context.Background(), "POST", srv.URL, strings.NewReader("body"))
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Error("Expected a single call, Got:", resp.StatusCode, calls)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var failing int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(Options{Breaker: &BreakerOptions{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond}})
+	get := func() error {
+		resp, err := c.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	get()
+	get()
+	if err := get(); err == nil || !strings.Contains(err.Error(), ErrCircuitOpen.Error()) {
+		t.Fatal("Expected:", ErrCircuitOpen, "Got:", err)
+	}
+
+	// after the timeout, a successful probe closes the breaker
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := New(Options{Bulkhead: &BulkheadOptions{MaxConcurrent: 1}})
+	go c.Get(srv.URL)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Get(srv.URL); err == nil || !strings.Contains(err.Error(), ErrBulkheadFull.Error()) {
+		t.Error("Expected:", ErrBulkheadFull, "Got:", err)
+	}
+}
+
+func TestBulkheadBody(t *testing.T) {
+	flush := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-flush:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(flush)
+
+	c := New(Options{Bulkhead: &BulkheadOptions{MaxConcurrent: 1}})
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the slot is held while the body is streamed
+	if _, err := c.Get(srv.URL); err == nil || !strings.Contains(err.Error(), ErrBulkheadFull.Error()) {
+		t.Error("Expected:", ErrBulkheadFull, "Got:", err)
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+	resp, err = c.Get(srv.URL)
+	if err != nil {
+		t.Fatal("Expected the slot to be released on Close, Got:", err)
+	}
+	resp.Body.Close()
+}
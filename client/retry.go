@@ -0,0 +1,150 @@
+package client
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy configures the retries of failed requests
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first. Defaults to 3.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every retry. Defaults to 100ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. A Retry-After longer than it isn't honoured
+	// and the response is returned. Defaults to 5s.
+	MaxDelay time.Duration
+	// Jitter is the fraction of each delay randomized, between 0 and 1, so that clients
+	// don't retry in lockstep
+	Jitter float64
+	// RetryNonIdempotent retries POST and PATCH requests too. They are retried only if
+	// they have an Idempotency-Key header otherwise.
+	RetryNonIdempotent bool
+	// Retryable decides whether an attempt is retried. Defaults to retrying transport errors,
+	// 429, 502, 503 and 504 responses.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	if p.Retryable == nil {
+		p.Retryable = defaultRetryable
+	}
+	return p
+}
+
+func defaultRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// circuit breaker and bulkhead rejections are not worth retrying right away
+		return err != ErrCircuitOpen && err != ErrBulkheadFull
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent reports whether req can be retried as per p
+func (p RetryPolicy) idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return p.RetryNonIdempotent || req.Header.Get("Idempotency-Key") != ""
+}
+
+// delay returns the delay before the attempt following attempt n, 1 being the first
+func (p RetryPolicy) delay(n int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, d <= p.MaxDelay
+		}
+	}
+	d := p.BaseDelay << uint(n-1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		j := float64(d) * p.Jitter
+		d = time.Duration(float64(d) - j + rand.Float64()*2*j)
+	}
+	return d, true
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(time.Now())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// roundTripWithRetries makes the request with attempt, retrying as per p
+func roundTripWithRetries(p RetryPolicy, req *http.Request, attempt func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	ctx := req.Context()
+	// the body must be replayable to retry
+	canRetry := p.idempotent(req) && (req.Body == nil || req.GetBody != nil)
+	for n := 1; ; n++ {
+		resp, err := attempt(req)
+		if !canRetry || n >= p.MaxAttempts || !p.Retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		d, ok := p.delay(n, resp)
+		if !ok {
+			return resp, err
+		}
+		if req.Body != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return resp, err
+			}
+			req = req.WithContext(ctx)
+			req.Body = body
+		}
+		if resp != nil {
+			// let the connection be reused
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
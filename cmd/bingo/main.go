@@ -0,0 +1,45 @@
+/*
+Command bingo runs the maintenance tasks of bingo services.
+
+	bingo migrate -dsn DSN -dir DIR [-dry-run] up [n] | down [n] | status
+
+migrate applies the migrations of the directory DIR to the MySQL database DSN, see package
+github.com/hifx/bingo/infra/mysql/migrate. DSN defaults to the MYSQL_DSN environment variable.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hifx/bingo/infra/mysql"
+	"github.com/hifx/bingo/infra/mysql/migrate"
+	"golang.org/x/net/context"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "migrate" {
+		fmt.Fprintln(os.Stderr, "usage: bingo migrate -dsn DSN -dir DIR", migrate.Usage)
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dsn := fs.String("dsn", os.Getenv("MYSQL_DSN"), "data source name of the database")
+	dir := fs.String("dir", "migrations", "directory of the migrations")
+	dryRun := fs.Bool("dry-run", false, "print the statements instead of running them")
+	fs.Parse(os.Args[2:])
+
+	db, err := mysql.Connect(*dsn, 1, 1)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	m := migrate.New(db.DB, os.DirFS(*dir))
+	m.DryRun = *dryRun
+	if err := migrate.Command(context.Background(), m, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
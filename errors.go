@@ -0,0 +1,233 @@
+package bingo
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// HTTPError is an error that knows how it should be presented to the client.
+// Errors returned by mux handlers that satisfy HTTPError are rendered as per the
+// request's Accept header, while the underlying error is only logged.
+type HTTPError interface {
+	error
+	// StatusCode is the HTTP status of the response
+	StatusCode() int
+	// Code is a stable, machine readable code for the error, e.g. "user.not_found"
+	Code() string
+	// Message is a human readable message that is safe to show to the client
+	Message() string
+	// Details holds additional information about the error, e.g. validation failures. Can be nil.
+	Details() interface{}
+	// Retryable tells the client whether the request can be retried as is
+	Retryable() bool
+}
+
+// Error is the default implementation of HTTPError
+type Error struct {
+	status    int
+	code      string
+	message   string
+	details   interface{}
+	retryable bool
+	cause     error
+	stack     []byte
+}
+
+// NewHTTPError returns an Error with the given status, public code and message. The stack
+// trace is captured for server errors (5xx) only. Errors are never modified once created, so
+// they can be declared once and shared between requests, e.g.
+//
+//	var ErrNotFound = bingo.NewHTTPError(http.StatusNotFound, "user.not_found", "user not found")
+//	...
+//	return ErrNotFound.WithCause(err)
+func NewHTTPError(status int, code, message string) *Error {
+	e := &Error{
+		status:  status,
+		code:    code,
+		message: message,
+	}
+	e.captureStack()
+	return e
+}
+
+// captureStack captures the stack trace of the caller for server errors
+func (e *Error) captureStack() {
+	if e.status >= http.StatusInternalServerError {
+		e.stack = debug.Stack()
+	}
+}
+
+// WithDetails returns a copy of e with the given details
+func (e *Error) WithDetails(d interface{}) *Error {
+	c := *e
+	c.details = d
+	return &c
+}
+
+// WithCause returns a copy of e caused by the internal error err. The cause is logged but never
+// sent to the client. The stack trace of server errors is captured again, at the time of the call.
+func (e *Error) WithCause(err error) *Error {
+	c := *e
+	c.cause = err
+	c.captureStack()
+	return &c
+}
+
+// MarkRetryable returns a copy of e marked as retryable
+func (e *Error) MarkRetryable() *Error {
+	c := *e
+	c.retryable = true
+	return &c
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s (cause: %s)", e.code, e.message, e.cause.Error())
+	}
+	return fmt.Sprintf("%s: %s", e.code, e.message)
+}
+
+// StatusCode returns the HTTP status of the error
+func (e *Error) StatusCode() int { return e.status }
+
+// Code returns the public code of the error
+func (e *Error) Code() string { return e.code }
+
+// Message returns the public message of the error
+func (e *Error) Message() string { return e.message }
+
+// Details returns the details of the error
+func (e *Error) Details() interface{} { return e.details }
+
+// Retryable reports whether the request can be retried
+func (e *Error) Retryable() bool { return e.retryable }
+
+// Cause returns the internal error that caused e, if any
+func (e *Error) Cause() error { return e.cause }
+
+// Stack returns the stack trace captured when the error was created or its cause set, empty
+// for client errors (4xx)
+func (e *Error) Stack() string { return string(e.stack) }
+
+const (
+	contentTypeProblem = "application/problem+json"
+	contentTypeJSON    = "application/json"
+	contentTypeText    = "text/plain"
+)
+
+// problem is the RFC 7807 representation of an HTTPError
+type problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	Retryable bool        `json:"retryable"`
+}
+
+// jsonError is the plain JSON representation of an HTTPError
+type jsonError struct {
+	Error struct {
+		Code      string      `json:"code,omitempty"`
+		Message   string      `json:"message"`
+		Details   interface{} `json:"details,omitempty"`
+		Retryable bool        `json:"retryable"`
+	} `json:"error"`
+}
+
+/*
+WriteError writes e to w. The representation is chosen based on the Accept header of r:
+
+	application/problem+json	RFC 7807 problem details
+	application/json		{"error": {"code": ..., "message": ..., "details": ..., "retryable": ...}}
+	anything else			the message as plain text
+*/
+func WriteError(w http.ResponseWriter, r *http.Request, e HTTPError) {
+	status := e.StatusCode()
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	msg := e.Message()
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+	ct := negotiateErrorType(r.Header.Get("Accept"))
+	switch ct {
+	case contentTypeProblem:
+		body, err = json.Marshal(problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    msg,
+			Instance:  r.URL.Path,
+			Code:      e.Code(),
+			Details:   e.Details(),
+			Retryable: e.Retryable(),
+		})
+	case contentTypeJSON:
+		var je jsonError
+		je.Error.Code = e.Code()
+		je.Error.Message = msg
+		je.Error.Details = e.Details()
+		je.Error.Retryable = e.Retryable()
+		body, err = json.Marshal(je)
+	}
+	if err != nil || ct == contentTypeText {
+		ct = contentTypeText
+		body = []byte(msg)
+	}
+
+	w.Header().Set("Content-Type", ct+"; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+// negotiateErrorType picks the error representation with the highest preference in the Accept header
+func negotiateErrorType(accept string) string {
+	best, bestQ := contentTypeText, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if _, err := fmt.Sscanf(v, "%g", &q); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			// q=0 refuses the representation
+			continue
+		}
+		var ct string
+		switch mt {
+		case contentTypeProblem:
+			ct = contentTypeProblem
+		case contentTypeJSON:
+			ct = contentTypeJSON
+		case contentTypeText, "text/*":
+			ct = contentTypeText
+		default:
+			continue
+		}
+		// problem+json is preferred over json on a tie, as it is the more specific representation
+		if q > bestQ || (q == bestQ && ct == contentTypeProblem) {
+			best, bestQ = ct, q
+		}
+	}
+	return best
+}
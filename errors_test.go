@@ -0,0 +1,81 @@
+package bingo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateErrorType(t *testing.T) {
+	cases := map[string]string{
+		"":                         contentTypeText,
+		"*/*":                      contentTypeText,
+		"text/html":                contentTypeText,
+		"application/json":         contentTypeJSON,
+		"application/problem+json": contentTypeProblem,
+		"application/json, application/problem+json":       contentTypeProblem,
+		"text/plain;q=0.5, application/json;q=0.9":         contentTypeJSON,
+		"application/json;q=0.1, text/plain":               contentTypeText,
+		"application/problem+json;q=0.2, application/json": contentTypeJSON,
+		"application/problem+json;q=0":                     contentTypeText,
+		"application/problem+json;q=0, application/json":   contentTypeJSON,
+		"application/json;q=0":                             contentTypeText,
+	}
+	for accept, expected := range cases {
+		if got := negotiateErrorType(accept); got != expected {
+			t.Error("Accept:", accept, "Expected:", expected, "Got:", got)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	e := NewHTTPError(http.StatusNotFound, "user.not_found", "user not found").
+		WithDetails(map[string]string{"id": "42"})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/users/42", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	WriteError(w, r, e)
+	if w.Code != http.StatusNotFound {
+		t.Error("Status: Expected:", http.StatusNotFound, "Got:", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentTypeProblem) {
+		t.Error("Content-Type: Expected:", contentTypeProblem, "Got:", ct)
+	}
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if p.Status != http.StatusNotFound || p.Code != "user.not_found" || p.Detail != "user not found" || p.Instance != "/users/42" {
+		t.Error("Unexpected problem:", p)
+	}
+
+	w = httptest.NewRecorder()
+	r.Header.Set("Accept", "text/plain")
+	WriteError(w, r, e.WithCause(http.ErrHandlerTimeout))
+	if body := strings.TrimSpace(w.Body.String()); body != "user not found" {
+		t.Error("Body: Expected:", "user not found", "Got:", body)
+	}
+	if strings.Contains(w.Body.String(), http.ErrHandlerTimeout.Error()) {
+		t.Error("Cause leaked to the client:", w.Body.String())
+	}
+}
+
+func TestErrorCopies(t *testing.T) {
+	sentinel := NewHTTPError(http.StatusNotFound, "user.not_found", "user not found")
+	e := sentinel.WithCause(http.ErrHandlerTimeout).WithDetails("42").MarkRetryable()
+	if sentinel.Cause() != nil || sentinel.Details() != nil || sentinel.Retryable() {
+		t.Error("Expected the sentinel to be left as is, Got:", sentinel)
+	}
+	if e.Cause() != http.ErrHandlerTimeout || e.Details() != "42" || !e.Retryable() {
+		t.Error("Unexpected copy:", e)
+	}
+	if sentinel.Stack() != "" {
+		t.Error("Expected no stack trace for a client error")
+	}
+	if NewHTTPError(http.StatusBadGateway, "upstream", "").Stack() == "" {
+		t.Error("Expected the stack trace of a server error")
+	}
+}
@@ -11,14 +11,10 @@ type Handler struct {
 	closers []io.Closer
 }
 
-// Close cleans up any resources
+// Close cleans up any resources. The closers are run in order of registration;
+// all of them are run even if some fail, and the failures are returned as Errors.
 func (h *Handler) Close() error {
-	for _, cls := range h.closers {
-		if err := cls.Close(); err != nil {
-			return err
-		}
-	}
-	return nil
+	return closeAll(h.closers, 0)
 }
 
 // AddCloser adds a closer
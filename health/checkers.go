@@ -0,0 +1,77 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/hifx/go-solr/solr"
+	"golang.org/x/net/context"
+)
+
+// Pinger is implemented by *sql.DB, *sqlx.DB and *mysql.RetryDB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SQL returns a Checker that pings the database
+func SQL(db Pinger) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// Redis returns a Checker that sends a PING over a connection from the pool, waiting for the
+// reply until ctx is done
+func Redis(pool *redis.Pool) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var timeout time.Duration
+		if d, ok := ctx.Deadline(); ok {
+			if timeout = time.Until(d); timeout <= 0 {
+				return context.DeadlineExceeded
+			}
+		}
+		c := pool.Get()
+		defer c.Close()
+		_, err := redis.DoWithTimeout(c, timeout, "PING")
+		return err
+	})
+}
+
+// Solr returns a Checker that pings the solr core
+func Solr(si *solr.SolrInterface) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		status, _, err := si.Ping()
+		if err != nil {
+			return err
+		}
+		if status != "OK" {
+			return fmt.Errorf("status expected to be 'OK' but got '%s'", status)
+		}
+		return nil
+	})
+}
+
+// HTTP returns a Checker that sends a GET request to url and expects a 2xx response.
+// http.DefaultClient is used if client is nil.
+func HTTP(url string, client *http.Client) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return nil
+	})
+}
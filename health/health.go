@@ -0,0 +1,257 @@
+/*
+Package health provides liveness and readiness endpoints backed by periodic checks
+of the dependencies of a service
+
+e.g. usage
+
+	h := health.New(10*time.Second, 2*time.Second).
+		AddReadiness("mysql", health.SQL(db)).
+		AddReadiness("redis", health.Redis(pool)).
+		AddReadiness("users-api", health.HTTP("http://users/healthz", nil))
+	h.Start()
+	defer h.Close()
+
+	m := mux.New()
+	h.Mount(m)
+
+The checks run in the background every interval, and the handlers serve the cached
+results, so probes from load balancers never hit the dependencies directly.
+*/
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hifx/bingo/mux"
+	"golang.org/x/net/context"
+)
+
+// Checker checks the health of a dependency
+type Checker interface {
+	// Check returns a non nil error if the dependency is unhealthy. It should return
+	// once ctx is done.
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter to allow the use of ordinary functions as Checkers
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ErrNotChecked is reported for checks that haven't completed yet
+var ErrNotChecked = errors.New("not checked yet")
+
+// Result is the outcome of the last run of a check
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+type check struct {
+	name     string
+	checker  Checker
+	liveness bool
+
+	mu     sync.RWMutex
+	result Result
+}
+
+// Health runs the registered checks periodically and serves their results
+type Health struct {
+	interval time.Duration
+	timeout  time.Duration
+	checks   []*check
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New returns a Health running the checks every interval, giving each check at most timeout to complete
+func New(interval, timeout time.Duration) *Health {
+	return &Health{
+		interval: interval,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// AddReadiness registers a check that must pass for the service to receive traffic.
+// A failing readiness check fails /readyz only.
+func (h *Health) AddReadiness(name string, c Checker) *Health {
+	h.checks = append(h.checks, &check{name: name, checker: c, result: Result{Status: statusFail, Error: ErrNotChecked.Error()}})
+	return h
+}
+
+// AddLiveness registers a check that must pass for the process to be considered alive.
+// A failing liveness check fails both /healthz and /readyz, and usually results in the process being restarted.
+func (h *Health) AddLiveness(name string, c Checker) *Health {
+	h.AddReadiness(name, c)
+	h.checks[len(h.checks)-1].liveness = true
+	return h
+}
+
+// Start runs all the checks once, then keeps running them in the background every interval.
+// Only the first call starts the checks, and none does once h is closed.
+func (h *Health) Start() {
+	h.mu.Lock()
+	if h.started || h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.started = true
+	h.mu.Unlock()
+
+	h.runAll()
+	go func() {
+		defer close(h.done)
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				h.runAll()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background checks, if they were started
+func (h *Health) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	started := h.started
+	close(h.stop)
+	h.mu.Unlock()
+
+	if started {
+		<-h.done
+	}
+	return nil
+}
+
+// runAll runs the checks concurrently and waits for all of them
+func (h *Health) runAll() {
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			c.run(h.timeout)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (c *check) run(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the checker doesn't honour ctx; leave it running and report the timeout
+		err = ctx.Err()
+	}
+
+	r := Result{
+		Status:    statusOK,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		r.Status = statusFail
+		r.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.result = r
+	c.mu.Unlock()
+}
+
+// report is the JSON response of the handlers
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (h *Health) report(livenessOnly bool) (report, bool) {
+	rep := report{Status: statusOK, Checks: map[string]Result{}}
+	healthy := true
+	for _, c := range h.checks {
+		if livenessOnly && !c.liveness {
+			continue
+		}
+		c.mu.RLock()
+		r := c.result
+		c.mu.RUnlock()
+		rep.Checks[c.name] = r
+		if r.Status != statusOK {
+			healthy = false
+			rep.Status = statusFail
+		}
+	}
+	return rep, healthy
+}
+
+func (h *Health) serve(w http.ResponseWriter, livenessOnly bool) error {
+	rep, healthy := h.report(livenessOnly)
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	d, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	_, err = w.Write(d)
+	return err
+}
+
+// Liveness is a mux handler reporting the liveness checks. It responds with 503 if any of them fails.
+func (h *Health) Liveness(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return h.serve(w, true)
+}
+
+// Readiness is a mux handler reporting all the checks. It responds with 503 if any of them fails.
+func (h *Health) Readiness(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return h.serve(w, false)
+}
+
+// Mount registers Liveness at /healthz and Readiness at /readyz on m
+func (h *Health) Mount(m *mux.Mux) {
+	m.Get("/healthz", h.Liveness)
+	m.Get("/readyz", h.Readiness)
+}
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hifx/bingo/infra/mysql/mysqltest"
+	"golang.org/x/net/context"
+)
+
+func get(t *testing.T, handler func(context.Context, http.ResponseWriter, *http.Request) error) (int, report) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	if err := handler(context.Background(), w, r); err != nil {
+		t.Fatal(err)
+	}
+	var rep report
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, rep
+}
+
+func TestHealth(t *testing.T) {
+	var runs, dbDown int32 = 0, 1
+	h := New(time.Hour, time.Second).
+		AddLiveness("disk", CheckerFunc(func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})).
+		AddReadiness("db", CheckerFunc(func(ctx context.Context) error {
+			if atomic.LoadInt32(&dbDown) == 1 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}))
+
+	// nothing is checked before Start
+	if code, rep := get(t, h.Readiness); code != http.StatusServiceUnavailable || rep.Checks["db"].Error != ErrNotChecked.Error() {
+		t.Error("Expected the checks not to have run, Got:", code, rep)
+	}
+
+	h.Start()
+	defer h.Close()
+	// a failing readiness check fails /readyz only
+	if code, rep := get(t, h.Liveness); code != http.StatusOK || rep.Status != statusOK || len(rep.Checks) != 1 {
+		t.Error("Expected /healthz to pass with the liveness checks only, Got:", code, rep)
+	}
+	code, rep := get(t, h.Readiness)
+	if code != http.StatusServiceUnavailable || rep.Status != statusFail || rep.Checks["db"].Error != "connection refused" || rep.Checks["disk"].Status != statusOK {
+		t.Error("Expected /readyz to fail, Got:", code, rep)
+	}
+
+	// the handlers serve the cached results
+	atomic.StoreInt32(&dbDown, 0)
+	get(t, h.Readiness)
+	get(t, h.Liveness)
+	if code, _ := get(t, h.Readiness); code != http.StatusServiceUnavailable || atomic.LoadInt32(&runs) != 1 {
+		t.Error("Expected the cached results to be served, Got:", code, atomic.LoadInt32(&runs))
+	}
+	h.runAll()
+	if code, _ := get(t, h.Readiness); code != http.StatusOK {
+		t.Error("Expected /readyz to pass once checked again, Got:", code)
+	}
+}
+
+func TestHealthTimeout(t *testing.T) {
+	f := mysqltest.New()
+	f.On(mysqltest.Ping).Delay(time.Second)
+	db := f.Open()
+	defer db.Close()
+
+	h := New(time.Hour, 20*time.Millisecond).
+		AddReadiness("mysql", SQL(db)).
+		AddReadiness("stuck", CheckerFunc(func(ctx context.Context) error {
+			select {}
+		}))
+	start := time.Now()
+	h.Start()
+	defer h.Close()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Error("Expected the checks to time out, took:", d)
+	}
+	_, rep := get(t, h.Readiness)
+	for _, name := range []string{"mysql", "stuck"} {
+		if r := rep.Checks[name]; r.Status != statusFail || r.Error != context.DeadlineExceeded.Error() {
+			t.Error(name, "Expected:", context.DeadlineExceeded, "Got:", r)
+		}
+	}
+}
+
+func TestHealthStartClose(t *testing.T) {
+	// closing a Health never started returns
+	New(time.Hour, time.Second).Close()
+
+	h := New(time.Hour, time.Second)
+	h.Start()
+	h.Start()
+	h.Close()
+	h.Close()
+}
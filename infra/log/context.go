@@ -0,0 +1,92 @@
+package log
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = 0
+	latestKey ctxKey = 1
+)
+
+// Discard is a Logger that drops all log events. It is returned by FromContext
+// when the context holds no logger.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Debug(keyvals ...interface{})       {}
+func (discard) Info(keyvals ...interface{})        {}
+func (discard) Error(keyvals ...interface{})       {}
+func (discard) Warn(keyvals ...interface{})        {}
+func (discard) Crit(keyvals ...interface{})        {}
+func (discard) With(keyvals ...interface{}) Logger { return Discard }
+
+// ReqIDKey is the context key of the request ID, as set by the request ID middlewares
+const ReqIDKey = "reqID"
+
+// ReqID returns the request ID in ctx, the empty string if there is none
+func ReqID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ReqIDKey).(string)
+	return id
+}
+
+// NewContext returns a copy of ctx that carries l
+func NewContext(ctx context.Context, l Logger) context.Context {
+	if h, ok := ctx.Value(latestKey).(*latest); ok {
+		h.set(l)
+	}
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// latest holds the last logger stored in a context derived from a tracked one
+type latest struct {
+	mu sync.Mutex
+	l  Logger
+}
+
+func (h *latest) set(l Logger) {
+	h.mu.Lock()
+	h.l = l
+	h.mu.Unlock()
+}
+
+func (h *latest) get() Logger {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.l
+}
+
+// TrackContext returns a copy of ctx keeping track of the loggers stored in the contexts
+// derived from it, for LatestFromContext
+func TrackContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, latestKey, &latest{l: FromContext(ctx)})
+}
+
+// LatestFromContext returns the last logger stored in ctx or in a context derived from it,
+// if ctx was tracked with TrackContext, e.g. for a recoverer to log a panic with the fields
+// the handlers added. It is FromContext otherwise.
+func LatestFromContext(ctx context.Context) Logger {
+	if h, ok := ctx.Value(latestKey).(*latest); ok {
+		return h.get()
+	}
+	return FromContext(ctx)
+}
+
+// FromContext returns the logger carried by ctx, or Discard if there is none.
+// Within a request served by a bingo mux it holds the request's fields, e.g.
+//
+//	log.FromContext(ctx).Info("msg", "order placed", "order_id", id)
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey).(Logger); ok {
+		return l
+	}
+	return Discard
+}
@@ -0,0 +1,313 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat is the format of the timestamp appended to the name of rotated files
+const backupTimeFormat = "20060102T150405.000"
+
+// ErrFileClosed is returned when writing to a closed File
+var ErrFileClosed = errors.New("log: file closed")
+
+// FileOptions configures the rotation of a log file. The zero value never rotates the file.
+type FileOptions struct {
+	// MaxSize is the size in bytes after which the file is rotated
+	MaxSize int64
+	// MaxAge is the time after which the file is rotated
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to retain. All are retained if 0.
+	MaxBackups int
+	// Compress gzips the rotated files
+	Compress bool
+	// ReopenOnSIGHUP reopens the file when the process receives a SIGHUP, for use with
+	// external tools like logrotate
+	ReopenOnSIGHUP bool
+}
+
+/*
+File is a log file that rotates itself as per its FileOptions. Rotated files are renamed
+with a timestamp suffix, e.g. error.log.20161017T150405.000, followed by a sequence number
+for those rotated within the same millisecond, e.g. error.log.20161017T150405.000-1, and
+compressed and pruned in the background.
+*/
+type File struct {
+	name string
+	opts FileOptions
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+
+	cleanMu sync.Mutex // serializes compression and pruning of backups
+	wg      sync.WaitGroup
+	sig     chan os.Signal
+	stop    chan struct{}
+}
+
+// OpenFile opens the log file name in append mode, creating it if needed
+func OpenFile(name string, o FileOptions) (*File, error) {
+	f := &File{name: name, opts: o}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if o.ReopenOnSIGHUP {
+		f.sig = make(chan os.Signal, 1)
+		f.stop = make(chan struct{})
+		signal.Notify(f.sig, syscall.SIGHUP)
+		f.wg.Add(1)
+		go f.reopenLoop()
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	fw, err := GetFile(f.name)
+	if err != nil {
+		return err
+	}
+	info, err := fw.Stat()
+	if err != nil {
+		fw.Close()
+		return err
+	}
+	f.f, f.size, f.openedAt = fw, info.Size(), time.Now()
+	return nil
+}
+
+func (f *File) reopenLoop() {
+	defer f.wg.Done()
+	for {
+		select {
+		case <-f.sig:
+			if err := f.Reopen(); err != nil {
+				logError("reopen", err)
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Write writes p to the file, rotating it first if p would exceed MaxSize or the file is older than MaxAge
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return 0, ErrFileClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) shouldRotate(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.openedAt) > f.opts.MaxAge
+}
+
+// Rotate renames the current file and opens a new one
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return ErrFileClosed
+	}
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	f.f = nil
+	backup := f.backupName(time.Now())
+	if err := os.Rename(f.name, backup); err != nil {
+		// keep writing to the current file rather than losing logs
+		if oerr := f.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.clean(backup)
+	}()
+	return nil
+}
+
+// backupName returns the name of the backup of the file rotated at t, with a sequence number
+// if a backup of the same millisecond exists
+func (f *File) backupName(t time.Time) string {
+	name := f.name + "." + t.UTC().Format(backupTimeFormat)
+	backup := name
+	for seq := 1; exists(backup) || exists(backup+".gz"); seq++ {
+		backup = name + "-" + strconv.Itoa(seq)
+	}
+	return backup
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// Reopen closes and reopens the file, e.g. after it has been moved by logrotate
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return ErrFileClosed
+	}
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	f.f = nil
+	return f.open()
+}
+
+// Close closes the file and waits for the background compression and pruning to complete
+func (f *File) Close() error {
+	f.mu.Lock()
+	if f.f == nil {
+		f.mu.Unlock()
+		return ErrFileClosed
+	}
+	err := f.f.Close()
+	f.f = nil
+	f.mu.Unlock()
+
+	if f.stop != nil {
+		signal.Stop(f.sig)
+		close(f.stop)
+	}
+	f.wg.Wait()
+	return err
+}
+
+// clean compresses the new backup if needed and removes the backups exceeding MaxBackups
+func (f *File) clean(backup string) {
+	f.cleanMu.Lock()
+	defer f.cleanMu.Unlock()
+
+	if f.opts.Compress {
+		if err := compress(backup); err != nil {
+			logError("compress", err)
+		}
+	}
+	if f.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, err := f.backups()
+	if err != nil {
+		logError("prune", err)
+		return
+	}
+	for i := 0; i < len(backups)-f.opts.MaxBackups; i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			logError("prune", err)
+		}
+	}
+}
+
+// backups returns the rotated files, oldest first
+func (f *File) backups() ([]string, error) {
+	dir, base := filepath.Split(f.name)
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		name string
+		ts   string
+		seq  int
+	}
+	var found []backup
+	for _, name := range names {
+		if !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		b := backup{name: filepath.Join(dir, name)}
+		b.ts = strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if i := strings.IndexByte(b.ts, '-'); i >= 0 {
+			if b.seq, err = strconv.Atoi(b.ts[i+1:]); err != nil {
+				continue
+			}
+			b.ts = b.ts[:i]
+		}
+		if _, err := time.Parse(backupTimeFormat, b.ts); err != nil {
+			continue
+		}
+		found = append(found, b)
+	}
+	// the timestamps sort lexically, the sequence numbers don't
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].ts != found[j].ts {
+			return found[i].ts < found[j].ts
+		}
+		return found[i].seq < found[j].seq
+	})
+	backups := make([]string, len(found))
+	for i, b := range found {
+		backups[i] = b.name
+	}
+	return backups, nil
+}
+
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gunzip(t *testing.T, name string) string {
+	fr, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+	gz, err := gzip.NewReader(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(d)
+}
+
+func TestFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bingo-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "app.log")
+	f, err := OpenFile(name, FileOptions{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _ := ioutil.ReadFile(name)
+	if string(d) != "fourth\n" {
+		t.Error("Current file: Expected:", "fourth\n", "Got:", string(d))
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatal("Backups: Expected 2, Got:", backups)
+	}
+	// the latest backups are kept, even if rotated within the same millisecond
+	for i, expected := range []string{"second\n", "third\n"} {
+		if !strings.HasSuffix(backups[i], ".gz") {
+			t.Error("Backup not compressed:", backups[i])
+			continue
+		}
+		if got := gunzip(t, backups[i]); got != expected {
+			t.Error("Backup:", backups[i], "Expected:", expected, "Got:", got)
+		}
+	}
+	if _, err := f.Write([]byte("x")); err != ErrFileClosed {
+		t.Error("Write after close: Expected:", ErrFileClosed, "Got:", err)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bingo-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "app.log")
+	f, err := OpenFile(name, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("before\n"))
+	// what logrotate does
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	if d, _ := ioutil.ReadFile(name); string(d) != "after\n" {
+		t.Error("Expected:", "after\n", "Got:", string(d))
+	}
+}
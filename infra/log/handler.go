@@ -0,0 +1,86 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// levelStatus is the JSON representation of a LevelFilter
+type levelStatus struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+/*
+LevelHandler returns an http.Handler to read and change the levels of the filters at runtime.
+The filters are keyed by the name used to address them.
+
+GET responds with the levels of all the filters
+
+	{"access":{"level":"info"},"error":{"level":"warn","modules":{"db":"debug"}}}
+
+PUT or POST changes a level, with the parameters logger, level and an optional module.
+An empty level removes the override of the module.
+
+	curl -X PUT 'localhost:8080/admin/log?logger=error&module=db&level=debug'
+
+The handler should only be mounted on an internal or authenticated route.
+*/
+func LevelHandler(filters map[string]*LevelFilter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD":
+		case "PUT", "POST":
+			if status, msg := setLevel(filters, r); status != http.StatusOK {
+				http.Error(w, msg, status)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		// the loggers and modules are sorted by name, as are the keys of the maps encoded
+		resp := map[string]levelStatus{}
+		for name, f := range filters {
+			s := levelStatus{Level: f.Level().String()}
+			for m, l := range f.ModuleLevels() {
+				if s.Modules == nil {
+					s.Modules = map[string]string{}
+				}
+				s.Modules[m] = l.String()
+			}
+			resp[name] = s
+		}
+		d, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d)
+	})
+}
+
+func setLevel(filters map[string]*LevelFilter, r *http.Request) (int, string) {
+	name, module, level := r.FormValue("logger"), r.FormValue("module"), r.FormValue("level")
+	f, ok := filters[name]
+	if !ok {
+		return http.StatusNotFound, "unknown logger: " + name
+	}
+	if level == "" && module != "" {
+		f.ClearModuleLevel(module)
+		return http.StatusOK, ""
+	}
+	l, err := ParseLevel(level)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if module != "" {
+		f.SetModuleLevel(module, l)
+	} else {
+		f.SetLevel(l)
+	}
+	return http.StatusOK, ""
+}
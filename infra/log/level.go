@@ -0,0 +1,164 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the severity of a log event
+type Level int32
+
+// Levels in increasing order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelCrit
+)
+
+// moduleKey is the key of the field holding the module name of a logger
+const moduleKey = "module"
+
+var levelNames = []string{"debug", "info", "warn", "error", "crit"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelCrit {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level for its name, one of debug, info, warn, error and crit
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("log: unknown level %q", s)
+}
+
+// LevelFilter holds the minimum level of a logger, and of its modules. It is safe for
+// concurrent use; levels can be changed while logging.
+type LevelFilter struct {
+	level int32
+
+	mu      sync.Mutex   // serializes writers of modules
+	modules atomic.Value // map[string]Level, replaced on every change
+}
+
+// NewLevelFilter returns a LevelFilter with l as the minimum level
+func NewLevelFilter(l Level) *LevelFilter {
+	f := &LevelFilter{level: int32(l)}
+	f.modules.Store(map[string]Level{})
+	return f
+}
+
+// Level returns the minimum level
+func (f *LevelFilter) Level() Level {
+	return Level(atomic.LoadInt32(&f.level))
+}
+
+// SetLevel sets the minimum level
+func (f *LevelFilter) SetLevel(l Level) {
+	atomic.StoreInt32(&f.level, int32(l))
+}
+
+// SetModuleLevel overrides the minimum level for loggers having the module field set to module
+func (f *LevelFilter) SetModuleLevel(module string, l Level) {
+	f.update(func(m map[string]Level) { m[module] = l })
+}
+
+// ClearModuleLevel removes the override of module
+func (f *LevelFilter) ClearModuleLevel(module string) {
+	f.update(func(m map[string]Level) { delete(m, module) })
+}
+
+// ModuleLevels returns a copy of the module overrides
+func (f *LevelFilter) ModuleLevels() map[string]Level {
+	m := map[string]Level{}
+	for k, v := range f.modules.Load().(map[string]Level) {
+		m[k] = v
+	}
+	return m
+}
+
+func (f *LevelFilter) update(fn func(map[string]Level)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := f.ModuleLevels()
+	fn(m)
+	f.modules.Store(m)
+}
+
+// Enabled reports whether events of level l are logged for module
+func (f *LevelFilter) Enabled(module string, l Level) bool {
+	if module != "" {
+		if min, ok := f.modules.Load().(map[string]Level)[module]; ok {
+			return l >= min
+		}
+	}
+	return l >= f.Level()
+}
+
+/*
+Filter returns a Logger that drops the events of next below the minimum level held by f.
+The module of a logger is set by adding a module field, and selects the module override of f
+
+	f := log.NewLevelFilter(log.LevelInfo)
+	l := log.Filter(log.NewLogger(os.Stderr, "json"), f)
+	dbl := l.With("module", "db")
+	f.SetModuleLevel("db", log.LevelDebug) // dbl logs debug events, l doesn't
+*/
+func Filter(next Logger, f *LevelFilter) Logger {
+	return filtered{next: next, filter: f}
+}
+
+type filtered struct {
+	next   Logger
+	filter *LevelFilter
+	module string
+}
+
+func (l filtered) Debug(keyvals ...interface{}) {
+	if l.filter.Enabled(l.module, LevelDebug) {
+		l.next.Debug(keyvals...)
+	}
+}
+
+func (l filtered) Info(keyvals ...interface{}) {
+	if l.filter.Enabled(l.module, LevelInfo) {
+		l.next.Info(keyvals...)
+	}
+}
+
+func (l filtered) Warn(keyvals ...interface{}) {
+	if l.filter.Enabled(l.module, LevelWarn) {
+		l.next.Warn(keyvals...)
+	}
+}
+
+func (l filtered) Error(keyvals ...interface{}) {
+	if l.filter.Enabled(l.module, LevelError) {
+		l.next.Error(keyvals...)
+	}
+}
+
+func (l filtered) Crit(keyvals ...interface{}) {
+	if l.filter.Enabled(l.module, LevelCrit) {
+		l.next.Crit(keyvals...)
+	}
+}
+
+func (l filtered) With(keyvals ...interface{}) Logger {
+	module := l.module
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if k, ok := keyvals[i].(string); ok && k == moduleKey {
+			module = fmt.Sprint(keyvals[i+1])
+		}
+	}
+	return filtered{next: l.next.With(keyvals...), filter: l.filter, module: module}
+}
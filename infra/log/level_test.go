@@ -0,0 +1,71 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	events *[]string
+}
+
+func (r recorder) log(level string)                   { *r.events = append(*r.events, level) }
+func (r recorder) Debug(keyvals ...interface{})       { r.log("debug") }
+func (r recorder) Info(keyvals ...interface{})        { r.log("info") }
+func (r recorder) Warn(keyvals ...interface{})        { r.log("warn") }
+func (r recorder) Error(keyvals ...interface{})       { r.log("error") }
+func (r recorder) Crit(keyvals ...interface{})        { r.log("crit") }
+func (r recorder) With(keyvals ...interface{}) Logger { return r }
+
+func TestFilter(t *testing.T) {
+	var events []string
+	f := NewLevelFilter(LevelWarn)
+	l := Filter(recorder{&events}, f)
+	db := l.With("module", "db")
+	f.SetModuleLevel("db", LevelDebug)
+
+	l.Info()
+	l.Warn()
+	db.Debug()
+	f.SetLevel(LevelCrit)
+	f.ClearModuleLevel("db")
+	l.Error()
+	db.Info()
+	db.Crit()
+
+	if got, expected := strings.Join(events, " "), "warn debug crit"; got != expected {
+		t.Error("Expected:", expected, "Got:", got)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	f := NewLevelFilter(LevelInfo)
+	h := LevelHandler(map[string]*LevelFilter{"error": f})
+
+	for _, c := range []struct {
+		method, query string
+		status        int
+	}{
+		{"PUT", "logger=error&module=db&level=debug", 200},
+		{"PUT", "logger=error&level=warn", 200},
+		{"PUT", "logger=error&level=loud", 400},
+		{"PUT", "logger=access&level=warn", 404},
+		{"DELETE", "", 405},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(c.method, "/admin/log?"+c.query, nil)
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Error(c.method, c.query, "Expected:", c.status, "Got:", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/log", nil)
+	h.ServeHTTP(w, req)
+	if got, expected := w.Body.String(), `{"error":{"level":"warn","modules":{"db":"debug"}}}`; got != expected {
+		t.Error("Expected:", expected, "Got:", got)
+	}
+}
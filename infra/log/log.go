@@ -4,6 +4,7 @@ Package log provides provides a minimal interface for structured logging
 package log
 
 import (
+	"io"
 	"log"
 	"os"
 
@@ -29,20 +30,14 @@ type Logger interface {
 	With(keyvals ...interface{}) Logger
 }
 
-// newLogger takes the name of the file and format of the logger as an argument, creates the file and returns
-// a leveled logger that logs to the file.
+// NewLogger returns a leveled logger that logs to w.
 // @format can have values logfmt or json. Default value is logfmt.
-func newLogger(file string, format string) Logger {
-	fw, err := GetFile(file)
-	if err != nil {
-		log.Fatal("error opening log file", err)
-	}
-
+func NewLogger(w io.Writer, format string) Logger {
 	var l gklog.Logger
 	if format == loggerFormatJSON {
-		l = gklog.NewJSONLogger(fw)
+		l = gklog.NewJSONLogger(w)
 	} else {
-		l = gklog.NewLogfmtLogger(fw)
+		l = gklog.NewLogfmtLogger(w)
 	}
 
 	kitlevels := gklevels.New(
@@ -59,14 +54,28 @@ func newLogger(file string, format string) Logger {
 	return levels{kitlevels}
 }
 
-//NewJSONLogger returns a Json Logger
-func NewJSONLogger(fle string) Logger {
-	return newLogger(fle, loggerFormatJSON)
+// newLogger takes the name of the file and format of the logger as an argument, opens the file and returns
+// a leveled logger that logs to the file. The file is rotated as per the optional FileOptions.
+func newLogger(file string, format string, opts []FileOptions) (Logger, error) {
+	var o FileOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	fw, err := OpenFile(file, o)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogger(fw, format), nil
+}
+
+//NewJSONLogger returns a Json Logger writing to the file fle
+func NewJSONLogger(fle string, opts ...FileOptions) (Logger, error) {
+	return newLogger(fle, loggerFormatJSON, opts)
 }
 
-//NewLogfmtLogger returns a LogfmtLogger Logger
-func NewLogfmtLogger(fle string) Logger {
-	return newLogger(fle, loggerFormatLogFmt)
+//NewLogfmtLogger returns a LogfmtLogger Logger writing to the file fle
+func NewLogfmtLogger(fle string, opts ...FileOptions) (Logger, error) {
+	return newLogger(fle, loggerFormatLogFmt, opts)
 }
 
 //GetFile opens a file in read/write to append data to it
@@ -109,3 +118,8 @@ func (l levels) Crit(keyvals ...interface{}) {
 func (l levels) With(keyvals ...interface{}) Logger {
 	return levels{l.kit.With(keyvals...)}
 }
+
+// logError reports errors of the log package itself, which can't go to the log
+func logError(op string, err error) {
+	log.Println("log:", op, "failed:", err)
+}
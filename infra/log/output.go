@@ -0,0 +1,162 @@
+package log
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Stdout returns a writer to the standard output. Closing it doesn't close os.Stdout.
+func Stdout() io.WriteCloser {
+	return nopCloser{os.Stdout}
+}
+
+// Stderr returns a writer to the standard error. Closing it doesn't close os.Stderr.
+func Stderr() io.WriteCloser {
+	return nopCloser{os.Stderr}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// multiWriter writes to all its writers
+type multiWriter []io.Writer
+
+/*
+MultiWriter returns a writer that duplicates its writes to all the writers ws, e.g. to log
+to a file and to syslog
+
+	l := log.NewLogger(log.MultiWriter(file, sl), "json")
+
+Unlike io.MultiWriter, a failing writer doesn't prevent the others from being written to;
+the first error is returned. Closing it closes the writers that are io.Closers.
+*/
+func MultiWriter(ws ...io.Writer) io.WriteCloser {
+	return multiWriter(ws)
+}
+
+func (m multiWriter) Write(p []byte) (int, error) {
+	var err error
+	for _, w := range m {
+		if _, werr := w.Write(p); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (m multiWriter) Close() error {
+	var err error
+	for _, w := range m {
+		if c, ok := w.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// DefaultAsyncBuffer is the number of writes buffered by an AsyncWriter by default
+const DefaultAsyncBuffer = 4096
+
+/*
+AsyncWriter writes to an underlying writer from a background goroutine, so that logging
+doesn't block on a slow disk or network. Writes are dropped, and counted, when the buffer
+is full.
+
+e.g. usage
+
+	w := log.Async(file, 0)
+	defer w.Close()
+	mux.Init(log.NewLogger(w, "json"), errlog)
+*/
+type AsyncWriter struct {
+	// accessed atomically, first for 64-bit alignment on 32-bit platforms
+	dropped      uint64
+	droppedBytes uint64
+	errors       uint64
+
+	w      io.Writer
+	ch     chan []byte
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.RWMutex // guards closed against concurrent sends on ch
+	closed bool
+
+	closeErr error
+}
+
+// Async returns an AsyncWriter writing to w, buffering up to size writes. DefaultAsyncBuffer is used if size is 0.
+func Async(w io.Writer, size int) *AsyncWriter {
+	if size <= 0 {
+		size = DefaultAsyncBuffer
+	}
+	a := &AsyncWriter{
+		w:    w,
+		ch:   make(chan []byte, size),
+		done: make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+func (a *AsyncWriter) loop() {
+	defer close(a.done)
+	for p := range a.ch {
+		if _, err := a.w.Write(p); err != nil {
+			atomic.AddUint64(&a.errors, 1)
+		}
+	}
+}
+
+// Write queues a copy of p. It never blocks; p is dropped if the buffer is full.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return 0, ErrFileClosed
+	}
+	// the caller may reuse p
+	c := make([]byte, len(p))
+	copy(c, p)
+	select {
+	case a.ch <- c:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		atomic.AddUint64(&a.droppedBytes, uint64(len(p)))
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of writes, and of bytes, dropped because the buffer was full
+func (a *AsyncWriter) Dropped() (writes, bytes uint64) {
+	return atomic.LoadUint64(&a.dropped), atomic.LoadUint64(&a.droppedBytes)
+}
+
+// Errors returns the number of writes that failed on the underlying writer
+func (a *AsyncWriter) Errors() uint64 {
+	return atomic.LoadUint64(&a.errors)
+}
+
+// Close flushes the buffered writes, then closes the underlying writer if it is an io.Closer
+func (a *AsyncWriter) Close() error {
+	a.once.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		close(a.ch)
+		a.mu.Unlock()
+		<-a.done
+		if c, ok := a.w.(io.Closer); ok {
+			a.closeErr = c.Close()
+		}
+	})
+	return a.closeErr
+}
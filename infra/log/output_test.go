@@ -0,0 +1,114 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type blockingWriter struct {
+	writing chan struct{}
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.writing <- struct{}{}
+	<-w.unblock
+	return w.buf.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	w := &blockingWriter{writing: make(chan struct{}, 2), unblock: make(chan struct{})}
+	a := Async(w, 1)
+	// the first write is picked up by the background goroutine, the second fills the
+	// buffer, the third is dropped
+	a.Write([]byte("a"))
+	<-w.writing
+	a.Write([]byte("b"))
+	a.Write([]byte("cc"))
+	close(w.unblock)
+	a.Close()
+
+	if got := w.buf.String(); got != "ab" {
+		t.Error("Expected:", "ab", "Got:", got)
+	}
+	if writes, bytes := a.Dropped(); writes != 1 || bytes != 2 {
+		t.Error("Dropped: Expected:", 1, 2, "Got:", writes, bytes)
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := Syslog("udp", pc.LocalAddr().String(), SyslogOptions{Facility: FacilityLocal0, AppName: "app", Hostname: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	NewLogger(s, "logfmt").Info("msg", "hello")
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<134>1 ") || !strings.Contains(msg, " host app ") || !strings.HasSuffix(msg, " msg=hello") {
+		t.Error("Unexpected message:", msg)
+	}
+
+	// the severity follows the level
+	NewLogger(s, "json").Error("msg", "failed")
+	if n, _, err = pc.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<131>1 ") {
+		t.Error("Unexpected message:", msg)
+	}
+}
+
+func TestSyslogUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bingo-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, err := net.Listen("unix", filepath.Join(dir, "log.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s, err := Syslog("unix", ln.Addr().String(), SyslogOptions{AppName: "app", Hostname: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLogger(s, "logfmt")
+	l.Warn("msg", "first")
+	l.Debug("msg", "second")
+	s.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	d, _ := ioutil.ReadAll(conn)
+	lines := strings.Split(string(d), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "<12>1 ") || !strings.HasSuffix(lines[0], " msg=first") ||
+		!strings.HasPrefix(lines[1], "<15>1 ") || lines[2] != "" {
+		t.Errorf("Expected 2 messages terminated by newlines, Got: %q", d)
+	}
+}
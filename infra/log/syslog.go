@@ -0,0 +1,200 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Syslog facilities and severities, as defined in RFC 5424
+const (
+	FacilityUser   = 1
+	FacilityLocal0 = 16
+	FacilityLocal7 = 23
+
+	SeverityCrit    = 2
+	SeverityErr     = 3
+	SeverityWarning = 4
+	SeverityNotice  = 5
+	SeverityInfo    = 6
+	SeverityDebug   = 7
+)
+
+// levelSeverities maps the levels of the lines logged by NewLogger to their severity
+var levelSeverities = map[string]int{
+	"dbug": SeverityDebug,
+	"info": SeverityInfo,
+	"warn": SeverityWarning,
+	"errr": SeverityErr,
+	"crit": SeverityCrit,
+}
+
+// SyslogOptions configures a SyslogWriter
+type SyslogOptions struct {
+	// Facility defaults to FacilityUser
+	Facility int
+	// Severity of the messages whose level is unknown. The severity of the lines logged by
+	// NewLogger follows their level. Defaults to SeverityInfo.
+	Severity int
+	// AppName defaults to the name of the executable
+	AppName string
+	// Hostname defaults to os.Hostname
+	Hostname string
+	// Timeout for connecting and writing. Defaults to 5s.
+	Timeout time.Duration
+}
+
+/*
+SyslogWriter writes each log line as an RFC 5424 message to a syslog server over udp, tcp
+or a unix socket. Messages over tcp are framed by octet counting as per RFC 6587, those over
+a unix stream socket are terminated by a newline, as local syslog daemons expect.
+
+e.g. usage
+
+	sl, err := log.Syslog("udp", "logs.internal:514", log.SyslogOptions{Facility: log.FacilityLocal0})
+	if err != nil {
+		return err
+	}
+	l := log.NewLogger(sl, "logfmt")
+
+The connection is re-established once if a write fails.
+*/
+type SyslogWriter struct {
+	network, addr string
+	o             SyslogOptions
+	pid           string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Syslog connects to the syslog server at addr. network is one of udp, tcp, unix or unixgram;
+// addr defaults to /dev/log for the unix networks.
+func Syslog(network, addr string, o SyslogOptions) (*SyslogWriter, error) {
+	if o.Facility == 0 {
+		o.Facility = FacilityUser
+	}
+	if o.Severity == 0 {
+		o.Severity = SeverityInfo
+	}
+	if o.AppName == "" {
+		o.AppName = filepath.Base(os.Args[0])
+	}
+	if o.Hostname == "" {
+		o.Hostname, _ = os.Hostname()
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if addr == "" && (network == "unix" || network == "unixgram") {
+		addr = "/dev/log"
+	}
+	s := &SyslogWriter{network: network, addr: addr, o: o, pid: strconv.Itoa(os.Getpid())}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyslogWriter) connect() error {
+	conn, err := net.DialTimeout(s.network, s.addr, s.o.Timeout)
+	if err != nil {
+		return fmt.Errorf("log: unable to connect to syslog at %s: %s", s.addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Write sends p, without its trailing newline, as a single syslog message
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	msg := s.format(bytes.TrimRight(p, "\n"), time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if err := s.send(msg); err == nil {
+			return len(p), nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return 0, err
+	}
+	if err := s.send(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *SyslogWriter) send(msg []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.o.Timeout))
+	// stream transports need framing
+	switch s.network {
+	case "tcp":
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	case "unix":
+		msg = append(msg, '\n')
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// format returns the RFC 5424 message: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+func (s *SyslogWriter) format(p []byte, t time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - - ",
+		s.o.Facility*8+severity(p, s.o.Severity),
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(s.o.Hostname),
+		nilValue(s.o.AppName),
+		s.pid)
+	b.Write(p)
+	return b.Bytes()
+}
+
+// severity returns the severity of the level of line p, as logged by NewLogger in logfmt or
+// json, or def if it has none
+func severity(p []byte, def int) int {
+	var level []byte
+	if i := bytes.Index(p, []byte(`"level":"`)); i >= 0 {
+		level = p[i+len(`"level":"`):]
+		if j := bytes.IndexByte(level, '"'); j >= 0 {
+			level = level[:j]
+		}
+	} else if i := bytes.Index(p, []byte("level=")); i == 0 || i > 0 && p[i-1] == ' ' {
+		level = p[i+len("level="):]
+		if j := bytes.IndexByte(level, ' '); j >= 0 {
+			level = level[:j]
+		}
+	}
+	if sev, ok := levelSeverities[string(level)]; ok {
+		return sev
+	}
+	return def
+}
+
+// nilValue returns the RFC 5424 NILVALUE for empty header fields
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Close closes the connection
+func (s *SyslogWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/exp"
+)
+
+// expvarSink publishes the metrics via expvar at /debug/metrics on http.DefaultServeMux
+type expvarSink struct{}
+
+var expOnce sync.Once
+
+// Expvar returns a Sink that publishes the metrics via expvar. This is the sink used when
+// Init is called without any sinks.
+func Expvar() Sink {
+	return expvarSink{}
+}
+
+func (expvarSink) Start(r metrics.Registry) error {
+	// exp registers its handler on http.DefaultServeMux, which panics if done twice
+	expOnce.Do(func() { exp.Exp(r) })
+	return nil
+}
+
+func (expvarSink) Close() error {
+	return nil
+}
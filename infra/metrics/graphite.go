@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+/*
+Graphite is a Sink that pushes the metrics to Graphite (carbon) using the plaintext
+protocol over TCP. A new connection is made for every push.
+
+Counters, gauges and meters are sent as "<prefix>.<name>.count" or "<prefix>.<name>.value".
+Histograms and timers are sent as count, min, max, mean and percentiles. Timer values
+are sent in milliseconds. Labels are sent as tags (Graphite 1.1+), e.g.
+"http_requests_total.count;method=GET;route=/users".
+*/
+type Graphite struct {
+	pusher
+	addr   string
+	prefix string
+}
+
+// NewGraphite returns a Graphite sink pushing to the carbon server at addr every interval
+func NewGraphite(addr, prefix string, interval time.Duration) (*Graphite, error) {
+	if _, err := net.ResolveTCPAddr("tcp", addr); err != nil {
+		return nil, fmt.Errorf("invalid graphite address: %s err: %s", addr, err)
+	}
+	g := &Graphite{addr: addr}
+	if prefix != "" {
+		g.prefix = flatName(prefix) + "."
+	}
+	g.pusher = newPusher(interval, g.push)
+	return g, nil
+}
+
+func (g *Graphite) push(r metrics.Registry) error {
+	conn, err := net.DialTimeout("tcp", g.addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("unable to connect to graphite: %s err: %s", g.addr, err)
+	}
+	defer conn.Close()
+
+	ts := time.Now().Unix()
+	w := bufio.NewWriter(conn)
+	// line writes a single metric. Labels are sent as graphite tags, e.g. "name.count;method=GET"
+	line := func(key, field, value string, extra ...labelPair) {
+		name, pairs := splitLabeledName(key)
+		var tags string
+		for _, p := range append(pairs, extra...) {
+			tags += ";" + graphiteTag(p.name) + "=" + graphiteTag(p.value)
+		}
+		fmt.Fprintf(w, "%s%s.%s%s %s %d\n", g.prefix, flatName(name), field, tags, value, ts)
+	}
+	distribution := func(name string, count int64, min, max int64, mean float64, ps []float64, unit float64) {
+		line(name, "count", fmt.Sprint(count))
+		line(name, "min", formatFloat(float64(min)/unit))
+		line(name, "max", formatFloat(float64(max)/unit))
+		line(name, "mean", formatFloat(mean/unit))
+		for i, q := range quantiles {
+			line(name, fmt.Sprintf("p%d", int(q*100)), formatFloat(ps[i]/unit))
+		}
+	}
+
+	r.Each(func(name string, i interface{}) {
+		switch m := i.(type) {
+		case metrics.Counter:
+			line(name, "count", fmt.Sprint(m.Count()))
+		case metrics.Gauge:
+			line(name, "value", fmt.Sprint(m.Value()))
+		case metrics.GaugeFloat64:
+			line(name, "value", formatFloat(m.Value()))
+		case metrics.Meter:
+			line(name, "count", fmt.Sprint(m.Snapshot().Count()))
+		case metrics.Histogram:
+			h := m.Snapshot()
+			distribution(name, h.Count(), h.Min(), h.Max(), h.Mean(), h.Percentiles(quantiles), 1)
+		case metrics.Timer:
+			t := m.Snapshot()
+			distribution(name, t.Count(), t.Min(), t.Max(), t.Mean(), t.Percentiles(quantiles), float64(time.Millisecond))
+		}
+	})
+	histograms.each(func(name string, h bucketSnapshot) {
+		line(name, "count", fmt.Sprint(h.count))
+		line(name, "sum", formatFloat(h.sum))
+		for i, b := range h.buckets {
+			line(name, "bucket", fmt.Sprint(h.counts[i]), labelPair{"le", formatFloat(b)})
+		}
+	})
+	return w.Flush()
+}
+
+var graphiteTagReplacer = strings.NewReplacer(";", "_", "=", "_", "~", "_", " ", "_", "\n", "_")
+
+func graphiteTag(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return graphiteTagReplacer.Replace(s)
+}
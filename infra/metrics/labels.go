@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Labels are the dimensions of a metric, e.g. {"route": "/users/:id", "method": "GET"}.
+// Keep the number of distinct values low: every combination is a separate series.
+type Labels map[string]string
+
+// DefBuckets are the default histogram buckets, tailored to measure request latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var constLabels = struct {
+	sync.RWMutex
+	l Labels
+}{}
+
+// SetConstLabels sets labels that are added to every labeled metric, e.g. {"service": "users"}.
+// It should be called before any labeled metric is recorded.
+func SetConstLabels(l Labels) {
+	constLabels.Lock()
+	constLabels.l = l
+	constLabels.Unlock()
+}
+
+type labelPair struct {
+	name, value string
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labeledName returns the key a labeled metric is stored under, e.g. `name{method="GET",route="/"}`.
+// Labels are sorted by name so that the same label set always maps to the same key.
+func labeledName(name string, l Labels) string {
+	constLabels.RLock()
+	cl := constLabels.l
+	constLabels.RUnlock()
+	if len(l) == 0 && len(cl) == 0 {
+		return name
+	}
+
+	all := make(map[string]string, len(l)+len(cl))
+	for k, v := range cl {
+		all[k] = v
+	}
+	for k, v := range l {
+		all[k] = v
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(all[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// splitLabeledName splits a key created by labeledName into the metric name and its labels.
+// Keys without labels are returned as is.
+func splitLabeledName(key string) (string, []labelPair) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	name, rest := key[:i], key[i+1:len(key)-1]
+
+	var pairs []labelPair
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			break
+		}
+		p := labelPair{name: rest[:eq]}
+		rest = rest[eq+2:]
+		var v bytes.Buffer
+		for len(rest) > 0 {
+			c := rest[0]
+			rest = rest[1:]
+			if c == '"' {
+				break
+			}
+			if c == '\\' && len(rest) > 0 {
+				c = rest[0]
+				rest = rest[1:]
+				if c == 'n' {
+					c = '\n'
+				}
+			}
+			v.WriteByte(c)
+		}
+		p.value = v.String()
+		pairs = append(pairs, p)
+		rest = strings.TrimPrefix(rest, ",")
+	}
+	return name, pairs
+}
+
+// Counter is a labeled counter
+type Counter struct {
+	name string
+}
+
+// NewCounter returns a labeled counter. By convention the name of counters ends in "_total".
+func NewCounter(name string) *Counter {
+	return &Counter{name: name}
+}
+
+// Inc increments the counter for the label set l by 1
+func (c *Counter) Inc(l Labels) {
+	c.Add(l, 1)
+}
+
+// Add increments the counter for the label set l by v
+func (c *Counter) Add(l Labels, v int64) {
+	metrics.GetOrRegisterCounter(labeledName(c.name, l), metrics.DefaultRegistry).Inc(v)
+}
+
+// Gauge is a labeled gauge
+type Gauge struct {
+	name string
+}
+
+// NewGauge returns a labeled gauge
+func NewGauge(name string) *Gauge {
+	return &Gauge{name: name}
+}
+
+// Set sets the gauge for the label set l to v
+func (g *Gauge) Set(l Labels, v float64) {
+	metrics.GetOrRegisterGaugeFloat64(labeledName(g.name, l), metrics.DefaultRegistry).Update(v)
+}
+
+// Histogram is a labeled histogram that counts observations in configurable buckets
+type Histogram struct {
+	name    string
+	buckets []float64
+}
+
+// NewHistogram returns a labeled histogram. The buckets are the upper bounds of the buckets, in increasing
+// order. DefBuckets is used if buckets is empty.
+func NewHistogram(name string, buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &Histogram{name: name, buckets: b}
+}
+
+// Observe adds the value v to the histogram for the label set l
+func (h *Histogram) Observe(l Labels, v float64) {
+	histograms.getOrRegister(labeledName(h.name, l), h.buckets).observe(v)
+}
+
+// Timer is a labeled histogram of durations, recorded in seconds
+type Timer struct {
+	h *Histogram
+}
+
+// NewTimer returns a labeled timer. The buckets are in seconds; DefBuckets is used if buckets is empty.
+// By convention the name of timers ends in "_seconds".
+func NewTimer(name string, buckets []float64) *Timer {
+	return &Timer{h: NewHistogram(name, buckets)}
+}
+
+// Observe records the duration d for the label set l
+func (t *Timer) Observe(l Labels, d time.Duration) {
+	t.h.Observe(l, d.Seconds())
+}
+
+// ObserveSince records the time elapsed since start for the label set l
+func (t *Timer) ObserveSince(l Labels, start time.Time) {
+	t.Observe(l, time.Since(start))
+}
+
+// bucketHistogram holds the observations of a single series of a Histogram
+type bucketHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []int64
+	sum     float64
+	count   int64
+}
+
+func (h *bucketHistogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// bucketSnapshot is a point in time copy of a bucketHistogram with cumulative bucket counts
+type bucketSnapshot struct {
+	buckets []float64
+	counts  []int64
+	sum     float64
+	count   int64
+}
+
+func (h *bucketHistogram) snapshot() bucketSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := bucketSnapshot{
+		buckets: h.buckets,
+		counts:  make([]int64, len(h.counts)),
+		sum:     h.sum,
+		count:   h.count,
+	}
+	var cum int64
+	for i, c := range h.counts {
+		cum += c
+		s.counts[i] = cum
+	}
+	return s
+}
+
+// histogramRegistry holds the bucket histograms. They are kept out of the go-metrics registry, which only
+// accepts its own metric types.
+type histogramRegistry struct {
+	mu sync.RWMutex
+	m  map[string]*bucketHistogram
+}
+
+var histograms = &histogramRegistry{m: map[string]*bucketHistogram{}}
+
+func (r *histogramRegistry) getOrRegister(key string, buckets []float64) *bucketHistogram {
+	r.mu.RLock()
+	h, ok := r.m[key]
+	r.mu.RUnlock()
+	if ok {
+		return h
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok = r.m[key]; !ok {
+		h = &bucketHistogram{buckets: buckets, counts: make([]int64, len(buckets))}
+		r.m[key] = h
+	}
+	return h
+}
+
+// each calls f with a snapshot of every bucket histogram
+func (r *histogramRegistry) each(f func(key string, s bucketSnapshot)) {
+	r.mu.RLock()
+	all := make(map[string]*bucketHistogram, len(r.m))
+	for k, h := range r.m {
+		all[k] = h
+	}
+	r.mu.RUnlock()
+	for k, h := range all {
+		f(k, h.snapshot())
+	}
+}
@@ -1,6 +1,21 @@
 /*
 Package metrics provides utilities for capturing counters gauges and histograms
 from various services written with bingo
+
+Metrics are recorded in an in-process registry and published by the sinks passed to Init.
+
+e.g. usage
+
+	prom := metrics.NewPrometheus()
+	statsd, err := metrics.NewStatsD("127.0.0.1:8125", "myservice", 10*time.Second)
+	if err != nil {
+		...
+	}
+	metrics.Init(prom, statsd)
+	defer metrics.Close()
+
+	m := mux.New()
+	m.Handle(pat.Get("/metrics"), prom)
 */
 package metrics
 
@@ -8,15 +23,48 @@ import (
 	"time"
 
 	"github.com/rcrowley/go-metrics"
-	"github.com/rcrowley/go-metrics/exp"
 )
 
+// Sink publishes the metrics held in a registry to a monitoring backend
+type Sink interface {
+	// Start starts publishing the metrics in r. It is called once by Init.
+	Start(r metrics.Registry) error
+	// Close stops publishing, flushing pending metrics if applicable
+	Close() error
+}
+
+var sinks []Sink
+
 // Init initializes the metrics lib . It registers the runtime memory stats
-//TODO: make it configurable to accept metrics publishers other than exp
-func Init() {
+// and starts the sinks provided. If no sink is provided, the metrics are
+// published via expvar.
+func Init(s ...Sink) error {
 	metrics.RegisterRuntimeMemStats(metrics.DefaultRegistry)
 	go metrics.CaptureRuntimeMemStats(metrics.DefaultRegistry, 60*time.Second)
-	exp.Exp(metrics.DefaultRegistry)
+
+	if len(s) == 0 {
+		s = []Sink{Expvar()}
+	}
+	for _, sink := range s {
+		if err := sink.Start(metrics.DefaultRegistry); err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	return nil
+}
+
+// Close stops all the sinks started by Init. All sinks are closed, even if one of them fails.
+// The first error encountered is returned.
+func Close() error {
+	var err error
+	for _, sink := range sinks {
+		if e := sink.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	sinks = nil
+	return err
 }
 
 // AddCounter increments a counter by 1
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// quantiles exposed for histograms and timers
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+var invalidPromChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+/*
+Prometheus is a Sink that exposes the metrics in the Prometheus text format
+(version 0.0.4) when served over HTTP. It does not push anything; mount it on a
+mux and point Prometheus at it.
+
+Names are sanitized to match [a-zA-Z_][a-zA-Z0-9_]*, e.g. "foo.:bar.latency"
+is exposed as "foo__bar_latency". Counters and meters are exposed as counters,
+gauges as gauges, histograms and timers as summaries, and the labeled
+Histogram and Timer as histograms. Timer values are exposed in seconds.
+*/
+type Prometheus struct {
+	mu       sync.RWMutex
+	registry metrics.Registry
+}
+
+// NewPrometheus returns a Prometheus sink
+func NewPrometheus() *Prometheus {
+	return &Prometheus{}
+}
+
+// Start sets the registry exposed by the handler
+func (p *Prometheus) Start(r metrics.Registry) error {
+	p.mu.Lock()
+	p.registry = r
+	p.mu.Unlock()
+	return nil
+}
+
+// Close is a no-op for Prometheus
+func (p *Prometheus) Close() error {
+	return nil
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	reg := p.registry
+	p.mu.RUnlock()
+	if reg == nil {
+		http.Error(w, "metrics not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	writePrometheus(bw, reg)
+	bw.Flush()
+}
+
+type promMetric struct {
+	name   string
+	labels string
+	metric interface{}
+}
+
+func writePrometheus(w *bufio.Writer, r metrics.Registry) {
+	var all []promMetric
+	add := func(key string, i interface{}) {
+		name, pairs := splitLabeledName(key)
+		all = append(all, promMetric{promName(name), promLabels(pairs), i})
+	}
+	r.Each(add)
+	histograms.each(func(key string, s bucketSnapshot) { add(key, s) })
+	sort.Sort(byPromName(all))
+
+	var last string
+	for _, m := range all {
+		var typ string
+		switch m.metric.(type) {
+		case metrics.Counter, metrics.Meter:
+			typ = "counter"
+		case metrics.Gauge, metrics.GaugeFloat64:
+			typ = "gauge"
+		case metrics.Histogram, metrics.Timer:
+			typ = "summary"
+		case bucketSnapshot:
+			typ = "histogram"
+		default:
+			continue
+		}
+		// series of the same metric must be grouped under a single TYPE line
+		if m.name != last {
+			fmt.Fprintf(w, "# TYPE %s %s\n", m.name, typ)
+			last = m.name
+		}
+
+		switch metric := m.metric.(type) {
+		case metrics.Counter:
+			writePromValue(w, m.name, m.labels, float64(metric.Count()))
+		case metrics.Gauge:
+			writePromValue(w, m.name, m.labels, float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			writePromValue(w, m.name, m.labels, metric.Value())
+		case metrics.Meter:
+			writePromValue(w, m.name, m.labels, float64(metric.Snapshot().Count()))
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			writePromSummary(w, m.name, m.labels, h.Percentiles(quantiles), float64(h.Sum()), h.Count(), 1)
+		case metrics.Timer:
+			t := metric.Snapshot()
+			writePromSummary(w, m.name, m.labels, t.Percentiles(quantiles), float64(t.Sum()), t.Count(), float64(time.Second))
+		case bucketSnapshot:
+			writePromHistogram(w, m.name, m.labels, metric)
+		}
+	}
+}
+
+func writePromValue(w *bufio.Writer, name, labels string, v float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, withLabels(labels, ""), formatFloat(v))
+}
+
+// writePromSummary writes a summary, dividing all values by unit
+func writePromSummary(w *bufio.Writer, name, labels string, ps []float64, sum float64, count int64, unit float64) {
+	for i, q := range quantiles {
+		fmt.Fprintf(w, "%s%s %s\n", name, withLabels(labels, `quantile="`+formatFloat(q)+`"`), formatFloat(ps[i]/unit))
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, withLabels(labels, ""), formatFloat(sum/unit))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, withLabels(labels, ""), count)
+}
+
+func writePromHistogram(w *bufio.Writer, name, labels string, s bucketSnapshot) {
+	for i, b := range s.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabels(labels, `le="`+formatFloat(b)+`"`), s.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabels(labels, `le="+Inf"`), s.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, withLabels(labels, ""), formatFloat(s.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, withLabels(labels, ""), s.count)
+}
+
+// promLabels formats the label pairs as `a="x",b="y"`
+func promLabels(pairs []labelPair) string {
+	ls := make([]string, len(pairs))
+	for i, p := range pairs {
+		ls[i] = promName(p.name) + `="` + labelValueEscaper.Replace(p.value) + `"`
+	}
+	return strings.Join(ls, ",")
+}
+
+// withLabels returns the label set in braces, with extra appended to the labels
+func withLabels(labels, extra string) string {
+	switch {
+	case labels == "" && extra == "":
+		return ""
+	case labels == "":
+		return "{" + extra + "}"
+	case extra == "":
+		return "{" + labels + "}"
+	}
+	return "{" + labels + "," + extra + "}"
+}
+
+func promName(name string) string {
+	n := invalidPromChars.ReplaceAllString(name, "_")
+	if n != "" && n[0] >= '0' && n[0] <= '9' {
+		n = "_" + n
+	}
+	return n
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type byPromName []promMetric
+
+func (b byPromName) Len() int      { return len(b) }
+func (b byPromName) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPromName) Less(i, j int) bool {
+	if b[i].name != b[j].name {
+		return b[i].name < b[j].name
+	}
+	return b[i].labels < b[j].labels
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestPrometheus(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("foo.:bar.request", r).Inc(3)
+	metrics.GetOrRegisterGauge("queue.size", r).Update(7)
+	metrics.GetOrRegisterTimer("foo.:bar.latency", r).Update(2 * time.Second)
+
+	p := NewPrometheus()
+	p.Start(r)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	p.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		"# TYPE foo__bar_request counter\nfoo__bar_request 3\n",
+		"# TYPE queue_size gauge\nqueue_size 7\n",
+		"# TYPE foo__bar_latency summary\n",
+		"foo__bar_latency{quantile=\"0.5\"} 2\n",
+		"foo__bar_latency_sum 2\n",
+		"foo__bar_latency_count 1\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Error("Expected:", expected, "Got:", body)
+		}
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(labeledName("http_requests_total", Labels{"route": "/", "method": "GET"}), r).Inc(2)
+	metrics.GetOrRegisterCounter(labeledName("http_requests_total", Labels{"route": "/", "method": "POST"}), r).Inc(1)
+	h := NewHistogram("test_duration_seconds", []float64{0.1, 1})
+	h.Observe(Labels{"route": `/"q"`}, 0.05)
+	h.Observe(Labels{"route": `/"q"`}, 0.5)
+	h.Observe(Labels{"route": `/"q"`}, 5)
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	writePrometheus(w, r)
+	w.Flush()
+
+	body := b.String()
+	for _, expected := range []string{
+		"# TYPE http_requests_total counter\n" +
+			"http_requests_total{method=\"GET\",route=\"/\"} 2\n" +
+			"http_requests_total{method=\"POST\",route=\"/\"} 1\n",
+		"# TYPE test_duration_seconds histogram\n" +
+			"test_duration_seconds_bucket{route=\"/\\\"q\\\"\",le=\"0.1\"} 1\n" +
+			"test_duration_seconds_bucket{route=\"/\\\"q\\\"\",le=\"1\"} 2\n" +
+			"test_duration_seconds_bucket{route=\"/\\\"q\\\"\",le=\"+Inf\"} 3\n" +
+			"test_duration_seconds_sum{route=\"/\\\"q\\\"\"} 5.55\n" +
+			"test_duration_seconds_count{route=\"/\\\"q\\\"\"} 3\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Error("Expected:", expected, "Got:", body)
+		}
+	}
+}
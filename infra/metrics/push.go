@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// pusher periodically flushes a registry to a backend. It is embedded by the push based sinks.
+type pusher struct {
+	interval time.Duration
+	flush    func(r metrics.Registry) error
+	registry metrics.Registry
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newPusher(interval time.Duration, flush func(metrics.Registry) error) pusher {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return pusher{
+		interval: interval,
+		flush:    flush,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts pushing the metrics in r every interval
+func (p *pusher) Start(r metrics.Registry) error {
+	p.registry = r
+	go p.loop()
+	return nil
+}
+
+// Close stops the pusher after a final flush
+func (p *pusher) Close() error {
+	var err error
+	p.once.Do(func() {
+		if p.registry == nil {
+			return
+		}
+		close(p.stop)
+		<-p.done
+		err = p.flush(p.registry)
+	})
+	return err
+}
+
+func (p *pusher) loop() {
+	defer close(p.done)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := p.flush(p.registry); err != nil {
+				log.Println("Error while pushing metrics:", err)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// counterDeltas tracks the last value pushed for cumulative metrics, so that backends which expect
+// increments (e.g. statsd) receive only the change since the previous push
+type counterDeltas map[string]int64
+
+func (c counterDeltas) delta(name string, v int64) int64 {
+	d := v - c[name]
+	c[name] = v
+	return d
+}
+
+var flatNameReplacer = strings.NewReplacer(" ", "_", ":", "_", "|", "_", "@", "_", "#", "_", "/", "_", "\n", "_")
+
+// flatName sanitizes name for the line based protocols
+func flatName(name string) string {
+	return flatNameReplacer.Replace(name)
+}
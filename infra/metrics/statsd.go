@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// maxUDPPayload keeps the packets below the common MTU of 1500 bytes
+const maxUDPPayload = 1432
+
+/*
+StatsD is a Sink that pushes the metrics to a StatsD (or DogStatsD) server over UDP.
+
+Counters and meters are sent as counter increments since the previous push. Gauges
+are sent as gauges. Histograms and timers are aggregated locally, so their count is
+sent as a counter and the min, max, mean and percentiles as gauges. Timer values
+are sent in milliseconds. The buckets of labeled histograms are sent as counters.
+
+Labels are sent as tags with DogStatsD. Plain StatsD has no notion of tags, so
+the labels are appended to the name, e.g. `http_requests_total.method.GET`.
+*/
+type StatsD struct {
+	pusher
+	conn   net.Conn
+	prefix string
+	tags   string
+	dog    bool
+	last   counterDeltas
+}
+
+// NewStatsD returns a StatsD sink pushing to the server at addr every interval. The metric names are
+// prefixed with prefix, if not empty.
+func NewStatsD(addr, prefix string, interval time.Duration) (*StatsD, error) {
+	return newStatsD(addr, prefix, nil, false, interval)
+}
+
+// NewDogStatsD returns a StatsD sink that uses the DogStatsD extensions to tag all metrics with tags,
+// e.g. []string{"env:prod", "service:users"}
+func NewDogStatsD(addr, prefix string, tags []string, interval time.Duration) (*StatsD, error) {
+	return newStatsD(addr, prefix, tags, true, interval)
+}
+
+func newStatsD(addr, prefix string, tags []string, dog bool, interval time.Duration) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to statsd: %s err: %s", addr, err)
+	}
+	s := &StatsD{
+		conn: conn,
+		dog:  dog,
+		last: counterDeltas{},
+	}
+	if prefix != "" {
+		s.prefix = flatName(prefix) + "."
+	}
+	if len(tags) > 0 {
+		s.tags = "|#" + strings.Join(tags, ",")
+	}
+	s.pusher = newPusher(interval, s.push)
+	return s, nil
+}
+
+// Close stops the sink after a final push and closes the connection
+func (s *StatsD) Close() error {
+	err := s.pusher.Close()
+	if e := s.conn.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *StatsD) push(r metrics.Registry) error {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	// line writes a single metric. key may carry labels, which are sent as tags with DogStatsD
+	// and appended to the name otherwise.
+	line := func(key, suffix, value, typ string, extra ...labelPair) {
+		name, pairs := splitLabeledName(key)
+		pairs = append(pairs, extra...)
+		tags := s.tags
+		if s.dog {
+			for _, p := range pairs {
+				if tags == "" {
+					tags = "|#"
+				} else {
+					tags += ","
+				}
+				tags += flatName(p.name) + ":" + flatName(p.value)
+			}
+		} else {
+			for _, p := range pairs {
+				name += "." + p.name + "." + strings.Replace(p.value, ".", "_", -1)
+			}
+		}
+		l := s.prefix + flatName(name+suffix) + ":" + value + "|" + typ + tags + "\n"
+		if buf.Len() > 0 && buf.Len()+len(l) > maxUDPPayload {
+			if _, e := s.conn.Write(buf.Bytes()); e != nil && err == nil {
+				err = e
+			}
+			buf.Reset()
+		}
+		buf.WriteString(l)
+	}
+	distribution := func(key string, count int64, min, max int64, mean float64, ps []float64, unit float64) {
+		line(key, ".count", fmt.Sprint(s.last.delta(key, count)), "c")
+		line(key, ".min", formatFloat(float64(min)/unit), "g")
+		line(key, ".max", formatFloat(float64(max)/unit), "g")
+		line(key, ".mean", formatFloat(mean/unit), "g")
+		for i, q := range quantiles {
+			line(key, fmt.Sprintf(".p%d", int(q*100)), formatFloat(ps[i]/unit), "g")
+		}
+	}
+
+	r.Each(func(key string, i interface{}) {
+		switch m := i.(type) {
+		case metrics.Counter:
+			line(key, "", fmt.Sprint(s.last.delta(key, m.Count())), "c")
+		case metrics.Gauge:
+			line(key, "", fmt.Sprint(m.Value()), "g")
+		case metrics.GaugeFloat64:
+			line(key, "", formatFloat(m.Value()), "g")
+		case metrics.Meter:
+			line(key, "", fmt.Sprint(s.last.delta(key, m.Snapshot().Count())), "c")
+		case metrics.Histogram:
+			h := m.Snapshot()
+			distribution(key, h.Count(), h.Min(), h.Max(), h.Mean(), h.Percentiles(quantiles), 1)
+		case metrics.Timer:
+			t := m.Snapshot()
+			distribution(key, t.Count(), t.Min(), t.Max(), t.Mean(), t.Percentiles(quantiles), float64(time.Millisecond))
+		}
+	})
+	// bucket counts are cumulative, so they are sent as increments like the counters
+	histograms.each(func(key string, h bucketSnapshot) {
+		line(key, ".count", fmt.Sprint(s.last.delta(key, h.count)), "c")
+		line(key, ".sum", formatFloat(h.sum), "g")
+		for i, b := range h.buckets {
+			le := formatFloat(b)
+			line(key, ".bucket", fmt.Sprint(s.last.delta(key+"le"+le, h.counts[i])), "c", labelPair{"le", le})
+		}
+	})
+	if buf.Len() > 0 {
+		if _, e := s.conn.Write(buf.Bytes()); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
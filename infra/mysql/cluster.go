@@ -0,0 +1,306 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/errgo"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+// Balance is the way reads are spread over the replicas of a Cluster
+type Balance int
+
+const (
+	// RoundRobin sends the reads to the healthy replicas in turn
+	RoundRobin Balance = iota
+	// LeastLatency sends the reads to the healthy replica answering the health checks the fastest
+	LeastLatency
+)
+
+// ClusterOptions configures a Cluster
+type ClusterOptions struct {
+	// Balance is the way reads are spread over the replicas
+	Balance Balance
+	// MaxLag ejects the replicas lagging behind the primary by more than it, until they catch up.
+	// Zero disables the check of the replication lag.
+	MaxLag time.Duration
+	// CheckInterval is the interval of the health checks of the replicas. Defaults to 5s.
+	CheckInterval time.Duration
+	// Lag returns the replication lag of a replica. Defaults to reading Seconds_Behind_Master
+	// from SHOW SLAVE STATUS.
+	Lag func(ctx context.Context, db *sqlx.DB) (time.Duration, error)
+	// Logger gets the ejections and readmissions of replicas
+	Logger log.Logger
+	// Options are the retry options of the connections
+	Options []Option
+}
+
+type ctxKey int
+
+const primaryKey ctxKey = 0
+
+// ForcePrimary returns a copy of ctx making the reads of a Cluster go to the primary, e.g. to
+// read the writes just made
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey).(bool)
+	return forced
+}
+
+// replica is a read replica of a Cluster, along with its latest health check
+type replica struct {
+	*RetryDB
+	name    string
+	healthy int32
+	latency int64
+}
+
+// Cluster is a MySQL primary with read replicas. Writes and transactions go to the primary,
+// reads to the healthy replicas, or to the primary if there are none.
+//
+// e.g. usage
+//
+//	c, err := mysql.ConnectCluster(primaryDSN, []string{replica1DSN, replica2DSN}, 20, 10, mysql.ClusterOptions{
+//		Balance: mysql.LeastLatency,
+//		MaxLag:  5 * time.Second,
+//	})
+//	...
+//	_, err = c.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", name, id)
+//	err = c.GetContext(mysql.ForcePrimary(ctx), &u, "SELECT * FROM users WHERE id = ?", id)
+type Cluster struct {
+	primary  *RetryDB
+	replicas []*replica
+	o        ClusterOptions
+	next     uint32
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// ConnectCluster connects to the primary and the replicas, with the connection limits of
+// ConnectWithRetry for each of them, and starts the health checks of the replicas
+func ConnectCluster(primary string, replicas []string, maxactive, maxidle int, o ClusterOptions) (*Cluster, error) {
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = 5 * time.Second
+	}
+	if o.Lag == nil {
+		o.Lag = SlaveStatusLag
+	}
+	if o.Logger == nil {
+		o.Logger = log.Discard
+	}
+	c := &Cluster{o: o, stop: make(chan struct{}), done: make(chan struct{})}
+	var err error
+	if c.primary, err = ConnectWithRetry(primary, maxactive, maxidle, o.Options...); err != nil {
+		return nil, err
+	}
+	for i, dsn := range replicas {
+		db, err := ConnectWithRetry(dsn, maxactive, maxidle, o.Options...)
+		if err != nil {
+			c.closeDBs()
+			return nil, errgo.New("unable to connect to replica " + strconv.Itoa(i) + ": " + err.Error())
+		}
+		c.replicas = append(c.replicas, &replica{RetryDB: db, name: "replica" + strconv.Itoa(i)})
+	}
+	c.check()
+	go c.loop()
+	return c, nil
+}
+
+// Primary returns the primary database
+func (c *Cluster) Primary() *RetryDB {
+	return c.primary
+}
+
+// Reader returns the database reads in ctx are sent to: a healthy replica picked as per the
+// Balance of c, or the primary if the replicas are all ejected or ctx forces it
+func (c *Cluster) Reader(ctx context.Context) *RetryDB {
+	if isPrimaryForced(ctx) {
+		return c.primary
+	}
+	var best *replica
+	if c.o.Balance == LeastLatency {
+		for _, r := range c.replicas {
+			if atomic.LoadInt32(&r.healthy) == 1 && (best == nil || atomic.LoadInt64(&r.latency) < atomic.LoadInt64(&best.latency)) {
+				best = r
+			}
+		}
+	} else {
+		healthy := make([]*replica, 0, len(c.replicas))
+		for _, r := range c.replicas {
+			if atomic.LoadInt32(&r.healthy) == 1 {
+				healthy = append(healthy, r)
+			}
+		}
+		if n := uint32(len(healthy)); n > 0 {
+			best = healthy[atomic.AddUint32(&c.next, 1)%n]
+		}
+	}
+	if best == nil {
+		return c.primary
+	}
+	return best.RetryDB
+}
+
+// GetContext runs the query on a replica, see Reader
+func (c *Cluster) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.Reader(ctx).GetContext(ctx, dest, query, args...)
+}
+
+// SelectContext runs the query on a replica, see Reader
+func (c *Cluster) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.Reader(ctx).SelectContext(ctx, dest, query, args...)
+}
+
+// QueryContext runs the query on a replica, see Reader
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.Reader(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryxContext runs the query on a replica, see Reader
+func (c *Cluster) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.Reader(ctx).QueryxContext(ctx, query, args...)
+}
+
+// ExecContext runs the query on the primary
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.ExecContext(ctx, query, args...)
+}
+
+// NamedExecContext runs the query on the primary
+func (c *Cluster) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return c.primary.NamedExecContext(ctx, query, arg)
+}
+
+// InTx runs fn in a transaction on the primary, see RetryDB.InTx
+func (c *Cluster) InTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) error {
+	return c.primary.InTx(ctx, opts, fn)
+}
+
+func (c *Cluster) loop() {
+	defer close(c.done)
+	t := time.NewTicker(c.o.CheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.check()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// check checks the health of the replicas, ejecting or readmitting them
+func (c *Cluster) check() {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			c.checkReplica(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) checkReplica(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.o.CheckInterval)
+	defer cancel()
+	start := time.Now()
+	err := r.DB.PingContext(ctx)
+	latency := time.Since(start)
+	var lag time.Duration
+	if err == nil && c.o.MaxLag > 0 {
+		if lag, err = c.o.Lag(ctx, r.DB); err == nil && lag > c.o.MaxLag {
+			err = errgo.New("replication lag of " + lag.String() + " exceeds " + c.o.MaxLag.String())
+		}
+	}
+	atomic.StoreInt64(&r.latency, int64(latency))
+	if err != nil {
+		if atomic.SwapInt32(&r.healthy, 0) == 1 {
+			c.o.Logger.Warn("msg", "replica ejected", "replica", r.name, "error", err.Error())
+		}
+		return
+	}
+	if atomic.SwapInt32(&r.healthy, 1) == 0 {
+		c.o.Logger.Info("msg", "replica admitted", "replica", r.name, "latency", latency.String(), "lag", lag.String())
+	}
+}
+
+// SlaveStatusLag returns the replication lag of db as per the Seconds_Behind_Source of SHOW
+// REPLICA STATUS, or the Seconds_Behind_Master of SHOW SLAVE STATUS on servers older than
+// MySQL 8.0.22. Replicas not replicating are in error.
+func SlaveStatusLag(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	lag, err := replicaStatusLag(ctx, db, "SHOW REPLICA STATUS")
+	var e *mysql.MySQLError
+	if errors.As(err, &e) && e.Number == erParse {
+		lag, err = replicaStatusLag(ctx, db, "SHOW SLAVE STATUS")
+	}
+	return lag, err
+}
+
+func replicaStatusLag(ctx context.Context, db *sqlx.DB, query string) (time.Duration, error) {
+	rows, err := db.QueryxContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errgo.New("not a replica")
+	}
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+	v, ok := status["Seconds_Behind_Source"]
+	if !ok {
+		v = status["Seconds_Behind_Master"]
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return 0, errgo.New("replication is not running")
+	}
+	s, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(s) * time.Second, nil
+}
+
+// Close stops the health checks and closes the databases
+func (c *Cluster) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+	return c.closeDBs()
+}
+
+func (c *Cluster) closeDBs() error {
+	var err error
+	if c.primary != nil {
+		err = c.primary.Close()
+	}
+	for _, r := range c.replicas {
+		if cerr := r.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
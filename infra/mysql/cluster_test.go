@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/hifx/bingo/infra/mysql/mysqltest"
+	"golang.org/x/net/context"
+)
+
+func TestClusterReader(t *testing.T) {
+	primary := &RetryDB{}
+	r0, r1, r2 := &replica{RetryDB: &RetryDB{}, healthy: 1, latency: 30}, &replica{RetryDB: &RetryDB{}, latency: 10}, &replica{RetryDB: &RetryDB{}, healthy: 1, latency: 20}
+	c := &Cluster{primary: primary, replicas: []*replica{r0, r1, r2}}
+	ctx := context.Background()
+
+	seen := map[*RetryDB]int{}
+	for i := 0; i < 4; i++ {
+		seen[c.Reader(ctx)]++
+	}
+	if seen[r0.RetryDB] != 2 || seen[r2.RetryDB] != 2 {
+		t.Error("Expected the reads spread over the healthy replicas, Got:", seen[r0.RetryDB], seen[r1.RetryDB], seen[r2.RetryDB])
+	}
+
+	c.o.Balance = LeastLatency
+	if db := c.Reader(ctx); db != r2.RetryDB {
+		t.Error("Expected the healthy replica with the least latency")
+	}
+	if db := c.Reader(ForcePrimary(ctx)); db != primary {
+		t.Error("Expected the primary when forced")
+	}
+	r0.healthy, r2.healthy = 0, 0
+	if db := c.Reader(ctx); db != primary {
+		t.Error("Expected the primary without healthy replicas")
+	}
+}
+
+func TestSlaveStatusLag(t *testing.T) {
+	f := mysqltest.New()
+	db := f.Open()
+	defer db.Close()
+
+	f.On("SHOW REPLICA STATUS").Times(1).Rows([]string{"Seconds_Behind_Source"}, []driver.Value{[]byte("3")})
+	if lag, err := SlaveStatusLag(context.Background(), db); err != nil || lag != 3*time.Second {
+		t.Error("Expected: 3s, Got:", lag, err)
+	}
+
+	// servers older than 8.0.22 only know SHOW SLAVE STATUS
+	f.On("SHOW REPLICA STATUS").Error(1064)
+	f.On("SHOW SLAVE STATUS").Rows([]string{"Seconds_Behind_Master"}, []driver.Value{[]byte("5")})
+	if lag, err := SlaveStatusLag(context.Background(), db); err != nil || lag != 5*time.Second || f.Count("SHOW SLAVE STATUS") != 1 {
+		t.Error("Expected: 5s from SHOW SLAVE STATUS, Got:", lag, err)
+	}
+
+	f.Reset()
+	f.On("SHOW REPLICA STATUS").Rows([]string{"Seconds_Behind_Source"}, []driver.Value{nil})
+	if _, err := SlaveStatusLag(context.Background(), db); err == nil {
+		t.Error("Expected an error for a replica not replicating")
+	}
+}
@@ -0,0 +1,328 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/hifx/errgo"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+var errNotConnected = errgo.New("Connection error: Please connect to the database")
+
+// notConnected fails every query with errNotConnected, for the rows of nil receivers
+var notConnected = sqlx.NewDb(sql.OpenDB(notConnectedConnector{}), "mysql")
+
+type notConnectedConnector struct{}
+
+func (notConnectedConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errNotConnected
+}
+
+func (notConnectedConnector) Driver() driver.Driver { return nil }
+
+// notConnectedRow returns a row whose Err is errNotConnected
+func notConnectedRow() *sqlx.Row {
+	return notConnected.QueryRowx("")
+}
+
+// mustExec panics if the call to Exec failed
+func mustExec(res sql.Result, err error) sql.Result {
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// QueryxContext is Queryx, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var rows *sqlx.Rows
+	err := rdb.run(ctx, "query", query, true, func(ctx context.Context) (err error) {
+		rows, err = rdb.DB.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowxContext is QueryRowx, with the attempts cancelled after the query timeout or when ctx is done.
+// The query is retried, not the scan of the row.
+func (rdb *RetryDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	if rdb == nil {
+		return notConnectedRow()
+	}
+	var row *sqlx.Row
+	rdb.run(ctx, "query", query, true, func(ctx context.Context) error {
+		row = rdb.DB.QueryRowxContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// QueryContext is Query, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var rows *sql.Rows
+	err := rdb.run(ctx, "query", query, true, func(ctx context.Context) (err error) {
+		rows, err = rdb.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// NamedQueryContext is NamedQuery, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var rows *sqlx.Rows
+	err := rdb.run(ctx, "query", query, true, func(ctx context.Context) (err error) {
+		rows, err = rdb.DB.NamedQueryContext(ctx, query, arg)
+		return err
+	})
+	return rows, err
+}
+
+// ExecContext is Exec, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var res sql.Result
+	err := rdb.run(ctx, "exec", query, false, func(ctx context.Context) (err error) {
+		res, err = rdb.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// MustExecContext is ExecContext, panicking on error
+func (rdb *RetryDB) MustExecContext(ctx context.Context, query string, args ...interface{}) sql.Result {
+	return mustExec(rdb.ExecContext(ctx, query, args...))
+}
+
+// NamedExecContext is NamedExec, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var res sql.Result
+	err := rdb.run(ctx, "exec", query, false, func(ctx context.Context) (err error) {
+		res, err = rdb.DB.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return res, err
+}
+
+// GetContext is Get, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if rdb == nil {
+		return errNotConnected
+	}
+	return rdb.run(ctx, "get", query, false, func(ctx context.Context) error {
+		return rdb.DB.GetContext(ctx, dest, query, args...)
+	})
+}
+
+// SelectContext is Select, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if rdb == nil {
+		return errNotConnected
+	}
+	return rdb.run(ctx, "select", query, false, func(ctx context.Context) error {
+		return rdb.DB.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// PrepareNamedContext is PrepareNamed, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) PrepareNamedContext(ctx context.Context, query string) (*RetryNamedStmt, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var stmt *sqlx.NamedStmt
+	err := rdb.run(ctx, "prepare", query, false, func(ctx context.Context) (err error) {
+		stmt, err = rdb.DB.PrepareNamedContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RetryNamedStmt{Stmt: stmt, retryPolicy: rdb.retryPolicy}, nil
+}
+
+// PreparexContext is Preparex, with the attempts cancelled after the query timeout or when ctx is done
+func (rdb *RetryDB) PreparexContext(ctx context.Context, query string) (*RetryStmt, error) {
+	if rdb == nil {
+		return nil, errNotConnected
+	}
+	var stmt *sqlx.Stmt
+	err := rdb.run(ctx, "prepare", query, false, func(ctx context.Context) (err error) {
+		stmt, err = rdb.DB.PreparexContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RetryStmt{Stmt: stmt, retryPolicy: rdb.retryPolicy, query: query}, nil
+}
+
+// ExecContext is Exec, with the attempts cancelled after the query timeout or when ctx is done
+func (n *RetryNamedStmt) ExecContext(ctx context.Context, arg interface{}) (sql.Result, error) {
+	if n == nil {
+		return nil, errNotConnected
+	}
+	var res sql.Result
+	err := n.run(ctx, "exec", n.Stmt.QueryString, false, func(ctx context.Context) (err error) {
+		res, err = n.Stmt.ExecContext(ctx, arg)
+		return err
+	})
+	return res, err
+}
+
+// MustExecContext is ExecContext, panicking on error
+func (n *RetryNamedStmt) MustExecContext(ctx context.Context, arg interface{}) sql.Result {
+	return mustExec(n.ExecContext(ctx, arg))
+}
+
+// QueryContext is Query, with the attempts cancelled after the query timeout or when ctx is done
+func (n *RetryNamedStmt) QueryContext(ctx context.Context, arg interface{}) (*sql.Rows, error) {
+	if n == nil {
+		return nil, errNotConnected
+	}
+	var rows *sql.Rows
+	err := n.run(ctx, "query", n.Stmt.QueryString, true, func(ctx context.Context) (err error) {
+		rows, err = n.Stmt.QueryContext(ctx, arg)
+		return err
+	})
+	return rows, err
+}
+
+// QueryxContext is Queryx, with the attempts cancelled after the query timeout or when ctx is done
+func (n *RetryNamedStmt) QueryxContext(ctx context.Context, arg interface{}) (*sqlx.Rows, error) {
+	if n == nil {
+		return nil, errNotConnected
+	}
+	var rows *sqlx.Rows
+	err := n.run(ctx, "query", n.Stmt.QueryString, true, func(ctx context.Context) (err error) {
+		rows, err = n.Stmt.QueryxContext(ctx, arg)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowxContext is QueryRowx, with the attempts cancelled after the query timeout or when ctx is done.
+// The query is retried, not the scan of the row.
+func (n *RetryNamedStmt) QueryRowxContext(ctx context.Context, arg interface{}) *sqlx.Row {
+	if n == nil {
+		return notConnectedRow()
+	}
+	var row *sqlx.Row
+	n.run(ctx, "query", n.Stmt.QueryString, true, func(ctx context.Context) error {
+		row = n.Stmt.QueryRowxContext(ctx, arg)
+		return row.Err()
+	})
+	return row
+}
+
+// GetContext is Get, with the attempts cancelled after the query timeout or when ctx is done
+func (n *RetryNamedStmt) GetContext(ctx context.Context, dest interface{}, arg interface{}) error {
+	if n == nil {
+		return errNotConnected
+	}
+	return n.run(ctx, "get", n.Stmt.QueryString, false, func(ctx context.Context) error {
+		return n.Stmt.GetContext(ctx, dest, arg)
+	})
+}
+
+// SelectContext is Select, with the attempts cancelled after the query timeout or when ctx is done
+func (n *RetryNamedStmt) SelectContext(ctx context.Context, dest interface{}, arg interface{}) error {
+	if n == nil {
+		return errNotConnected
+	}
+	return n.run(ctx, "select", n.Stmt.QueryString, false, func(ctx context.Context) error {
+		return n.Stmt.SelectContext(ctx, dest, arg)
+	})
+}
+
+// ExecContext is Exec, with the attempts cancelled after the query timeout or when ctx is done
+func (rs *RetryStmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	if rs == nil {
+		return nil, errNotConnected
+	}
+	var res sql.Result
+	err := rs.run(ctx, "exec", rs.query, false, func(ctx context.Context) (err error) {
+		res, err = rs.Stmt.ExecContext(ctx, args...)
+		return err
+	})
+	return res, err
+}
+
+// MustExecContext is ExecContext, panicking on error
+func (rs *RetryStmt) MustExecContext(ctx context.Context, args ...interface{}) sql.Result {
+	return mustExec(rs.ExecContext(ctx, args...))
+}
+
+// QueryContext is Query, with the attempts cancelled after the query timeout or when ctx is done
+func (rs *RetryStmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	if rs == nil {
+		return nil, errNotConnected
+	}
+	var rows *sql.Rows
+	err := rs.run(ctx, "query", rs.query, true, func(ctx context.Context) (err error) {
+		rows, err = rs.Stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryxContext is Queryx, with the attempts cancelled after the query timeout or when ctx is done
+func (rs *RetryStmt) QueryxContext(ctx context.Context, args ...interface{}) (*sqlx.Rows, error) {
+	if rs == nil {
+		return nil, errNotConnected
+	}
+	var rows *sqlx.Rows
+	err := rs.run(ctx, "query", rs.query, true, func(ctx context.Context) (err error) {
+		rows, err = rs.Stmt.QueryxContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowxContext is QueryRowx, with the attempts cancelled after the query timeout or when ctx is done.
+// The query is retried, not the scan of the row.
+func (rs *RetryStmt) QueryRowxContext(ctx context.Context, args ...interface{}) *sqlx.Row {
+	if rs == nil {
+		return notConnectedRow()
+	}
+	var row *sqlx.Row
+	rs.run(ctx, "query", rs.query, true, func(ctx context.Context) error {
+		row = rs.Stmt.QueryRowxContext(ctx, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// GetContext is Get, with the attempts cancelled after the query timeout or when ctx is done
+func (rs *RetryStmt) GetContext(ctx context.Context, dest interface{}, args ...interface{}) error {
+	if rs == nil {
+		return errNotConnected
+	}
+	return rs.run(ctx, "get", rs.query, false, func(ctx context.Context) error {
+		return rs.Stmt.GetContext(ctx, dest, args...)
+	})
+}
+
+// SelectContext is Select, with the attempts cancelled after the query timeout or when ctx is done
+func (rs *RetryStmt) SelectContext(ctx context.Context, dest interface{}, args ...interface{}) error {
+	if rs == nil {
+		return errNotConnected
+	}
+	return rs.run(ctx, "select", rs.query, false, func(ctx context.Context) error {
+		return rs.Stmt.SelectContext(ctx, dest, args...)
+	})
+}
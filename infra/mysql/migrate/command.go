@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"golang.org/x/net/context"
+)
+
+// Usage is the usage of Command
+const Usage = "[-dry-run] up [n] | down [n] | status"
+
+// Command runs the command line args with m: up applies the migrations not applied yet, or
+// the next n of them; down reverts the last migration applied, or the last n of them; status
+// lists the migrations. -dry-run prints the statements instead of running them.
+func Command(ctx context.Context, m *Migrator, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(m.Out)
+	fs.BoolVar(&m.DryRun, "dry-run", m.DryRun, "print the statements instead of running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: migrate %s", Usage)
+	}
+	n := 0
+	if len(args) == 2 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+			return fmt.Errorf("migrate: invalid number of migrations %q", args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx, n)
+	case "down":
+		return m.Down(ctx, n)
+	case "status":
+		ss, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(m.Out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range ss {
+			status, at := "pending", ""
+			if s.Applied {
+				status, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+				if s.Modified {
+					status = "modified"
+				}
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, at)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("usage: migrate %s", Usage)
+}
@@ -0,0 +1,441 @@
+/*
+Package migrate applies versioned schema changes to a MySQL database.
+
+Migrations are pairs of SQL files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+read from a directory or any fs.FS, e.g. one embedded in the service binary. The versions
+applied are recorded along with the checksum of their up file in the schema_migrations table,
+and a MySQL advisory lock makes sure only one instance migrates at a time. The statements of
+a file are run one by one; the bodies of triggers and procedures are set apart with DELIMITER
+lines, as with the mysql client.
+
+e.g. usage
+
+	//go:embed migrations/*.sql
+	var migrations embed.FS
+
+	src, _ := fs.Sub(migrations, "migrations")
+	m := migrate.New(db.DB.DB, src)
+	if err := m.Up(ctx, 0); err != nil {
+		...
+	}
+*/
+package migrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultTable is the table the applied migrations are recorded in
+	DefaultTable = "schema_migrations"
+	// DefaultLockName is the name of the advisory lock taken while migrating
+	DefaultLockName = "bingo_migrate"
+	// DefaultLockTimeout is the time waited for the lock held by another instance
+	DefaultLockTimeout = time.Minute
+)
+
+// erNoSuchTable is the MySQL error of a table that doesn't exist
+const erNoSuchTable = 1146
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set if the up file changed after the migration was applied
+	Modified bool
+}
+
+// Load reads the migrations of fsys, sorted by version. Every version must have an up file,
+// the down file is optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		version, name, up, err := parseName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		d, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, m.Name, name)
+		}
+		if up {
+			m.Up = string(d)
+			sum := sha256.Sum256(d)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(d)
+		}
+	}
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up file", m.Version)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// parseName parses the name of a migration file, <version>_<name>.up.sql or <version>_<name>.down.sql
+func parseName(file string) (version int64, name string, up bool, err error) {
+	base := strings.TrimSuffix(file, ".sql")
+	switch path.Ext(base) {
+	case ".up":
+		up = true
+	case ".down":
+	default:
+		return 0, "", false, fmt.Errorf("migrate: %s is neither an up nor a down file", file)
+	}
+	base = strings.TrimSuffix(base, path.Ext(base))
+	i := strings.IndexByte(base, '_')
+	if i < 0 {
+		return 0, "", false, fmt.Errorf("migrate: %s has no version", file)
+	}
+	if version, err = strconv.ParseInt(base[:i], 10, 64); err != nil {
+		return 0, "", false, fmt.Errorf("migrate: %s has an invalid version", file)
+	}
+	return version, base[i+1:], up, nil
+}
+
+// Migrator applies the migrations of a source to a database
+type Migrator struct {
+	// Table is the table the applied migrations are recorded in. Defaults to DefaultTable.
+	Table string
+	// LockName is the name of the advisory lock taken while migrating. Defaults to DefaultLockName.
+	LockName string
+	// LockTimeout is the time waited for the lock held by another instance. Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+	// DryRun prints the statements that would be run to Out instead of running them
+	DryRun bool
+	// Out gets the progress and the statements of dry runs. Defaults to os.Stdout.
+	Out io.Writer
+
+	db     *sql.DB
+	source fs.FS
+}
+
+// New returns a Migrator applying the migrations of source to db
+func New(db *sql.DB, source fs.FS) *Migrator {
+	return &Migrator{
+		Table:       DefaultTable,
+		LockName:    DefaultLockName,
+		LockTimeout: DefaultLockTimeout,
+		Out:         os.Stdout,
+		db:          db,
+		source:      source,
+	}
+}
+
+// Up applies the next n migrations not applied yet, all of them if n <= 0
+func (m *Migrator) Up(ctx context.Context, n int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		ms, applied, err := m.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			n = len(ms)
+		}
+		for _, mg := range ms {
+			if a, ok := applied[mg.Version]; ok {
+				if a.checksum != mg.Checksum {
+					return fmt.Errorf("migrate: %d_%s was modified after it was applied", mg.Version, mg.Name)
+				}
+				continue
+			}
+			if n == 0 {
+				break
+			}
+			if err := m.apply(ctx, conn, mg, mg.Up, "up"); err != nil {
+				return err
+			}
+			if !m.DryRun {
+				if _, err := conn.ExecContext(ctx, "INSERT INTO "+m.Table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)", mg.Version, mg.Name, mg.Checksum, time.Now().UTC()); err != nil {
+					return err
+				}
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Down reverts the last n migrations applied, 1 if n <= 0
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n <= 0 {
+		n = 1
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		ms, applied, err := m.state(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(ms) - 1; i >= 0 && n > 0; i-- {
+			mg := ms[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("migrate: %d_%s has no down file", mg.Version, mg.Name)
+			}
+			if err := m.apply(ctx, conn, mg, mg.Down, "down"); err != nil {
+				return err
+			}
+			if !m.DryRun {
+				if _, err := conn.ExecContext(ctx, "DELETE FROM "+m.Table+" WHERE version = ?", mg.Version); err != nil {
+					return err
+				}
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Status returns the state of the migrations of the source, sorted by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ms, applied, err := m.state(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	ss := make([]Status, len(ms))
+	for i, mg := range ms {
+		ss[i].Migration = mg
+		if a, ok := applied[mg.Version]; ok {
+			ss[i].Applied = true
+			ss[i].AppliedAt = a.at
+			ss[i].Modified = a.checksum != mg.Checksum
+		}
+	}
+	return ss, nil
+}
+
+// apply runs the statements of the up or down sql of mg
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, query, direction string) error {
+	fmt.Fprintf(m.Out, "-- %s %d_%s\n", direction, mg.Version, mg.Name)
+	for _, stmt := range Split(query) {
+		if m.DryRun {
+			fmt.Fprintf(m.Out, "%s;\n", stmt)
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: %s %d_%s: %s", direction, mg.Version, mg.Name, err)
+		}
+	}
+	return nil
+}
+
+type applied struct {
+	checksum string
+	at       time.Time
+}
+
+// state returns the migrations of the source and the ones recorded in the database
+func (m *Migrator) state(ctx context.Context, conn *sql.Conn) ([]Migration, map[int64]applied, error) {
+	ms, err := Load(m.source)
+	if err != nil {
+		return nil, nil, err
+	}
+	as := map[int64]applied{}
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM "+m.Table)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == erNoSuchTable {
+			return ms, as, nil
+		}
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version int64
+			a       applied
+			at      string
+		)
+		if err := rows.Scan(&version, &a.checksum, &at); err != nil {
+			return nil, nil, err
+		}
+		a.at = parseTime(at)
+		as[version] = a
+	}
+	return ms, as, rows.Err()
+}
+
+// parseTime parses a DATETIME, scanned as is or as a time.Time if the DSN has parseTime set
+func parseTime(s string) time.Time {
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t
+	}
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// locked runs fn on a connection holding the advisory lock, once the migrations table exists
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.DryRun {
+		// dry runs change nothing, there is nothing to protect
+		return fn(conn)
+	}
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.LockName, int(m.LockTimeout/time.Second)).Scan(&got); err != nil {
+		return err
+	}
+	if got.Int64 != 1 {
+		return fmt.Errorf("migrate: unable to get the lock %s within %s, another instance is migrating", m.LockName, m.LockTimeout)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", m.LockName)
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.Table+` (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at DATETIME NOT NULL
+)`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// Split splits sql into statements on the semicolons outside of quotes and comments.
+// Comments are kept with the statement following them; empty statements are dropped.
+// As with the mysql client, a DELIMITER line changes the delimiter of the statements that
+// follow, e.g. for the bodies of triggers and procedures.
+func Split(sql string) []string {
+	var (
+		stmts []string
+		b     bytes.Buffer
+		delim = ";"
+	)
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" && !onlyComments(s) {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(sql); i++ {
+		if i == 0 || sql[i-1] == '\n' {
+			j := strings.IndexByte(sql[i:], '\n')
+			if j < 0 {
+				j = len(sql) - i
+			}
+			if d, ok := delimiterOf(sql[i : i+j]); ok {
+				flush()
+				delim = d
+				i += j
+				continue
+			}
+		}
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\\' && c != '`' {
+					j++
+				} else if sql[j] == c {
+					break
+				}
+			}
+			b.WriteString(sql[i:min(j+1, len(sql))])
+			i = j
+		case c == '#' || strings.HasPrefix(sql[i:], "-- ") || strings.HasPrefix(sql[i:], "--\n"):
+			j := strings.IndexByte(sql[i:], '\n')
+			if j < 0 {
+				j = len(sql) - i - 1
+			}
+			b.WriteString(sql[i : i+j+1])
+			i += j
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			j := strings.Index(sql[i+2:], "*/")
+			if j < 0 {
+				j = len(sql) - i - 4
+			}
+			b.WriteString(sql[i:min(i+j+4, len(sql))])
+			i += j + 3
+		case strings.HasPrefix(sql[i:], delim):
+			flush()
+			i += len(delim) - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// delimiterOf returns the delimiter set by line if it is a DELIMITER command
+func delimiterOf(line string) (string, bool) {
+	f := strings.Fields(line)
+	if len(f) != 2 || !strings.EqualFold(f[0], "DELIMITER") {
+		return "", false
+	}
+	return f[1], true
+}
+
+// onlyComments reports whether the statement s holds nothing but comments
+func onlyComments(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "#") && !(strings.HasPrefix(line, "/*") && strings.HasSuffix(line, "*/")) {
+			return false
+		}
+	}
+	return true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(fstest.MapFS{
+		"2_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email VARCHAR(255);")},
+		"2_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+		"1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY);")},
+		"1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":               {Data: []byte("migrations")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Version != 1 || ms[0].Name != "create_users" || ms[1].Version != 2 || ms[1].Down != "ALTER TABLE users DROP email;" {
+		t.Fatalf("Unexpected migrations: %+v", ms)
+	}
+	if len(ms[0].Checksum) != 64 || ms[0].Checksum == ms[1].Checksum {
+		t.Error("Unexpected checksums:", ms[0].Checksum, ms[1].Checksum)
+	}
+
+	for _, fsys := range []fstest.MapFS{
+		{"1_users.down.sql": {Data: []byte("DROP TABLE users;")}},
+		{"users.up.sql": {Data: []byte("CREATE TABLE users (id INT);")}},
+		{"1_users.sql": {Data: []byte("CREATE TABLE users (id INT);")}},
+		{"1_users.up.sql": {}, "1_accounts.up.sql": {}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Error("Expected an error for", fsys)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	got := Split(`-- users
+CREATE TABLE users (id INT, name VARCHAR(16) DEFAULT 'a;b');
+INSERT INTO users VALUES (1, "it\"s;"); # trailing
+/* block; comment */ UPDATE ` + "`a;b`" + ` SET x = 1;
+-- only a comment;
+`)
+	expected := []string{
+		"-- users\nCREATE TABLE users (id INT, name VARCHAR(16) DEFAULT 'a;b')",
+		`INSERT INTO users VALUES (1, "it\"s;")`,
+		"# trailing\n/* block; comment */ UPDATE `a;b` SET x = 1",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %q Got: %q", expected, got)
+	}
+
+	got = Split(`DELIMITER $$
+CREATE TRIGGER users_bi BEFORE INSERT ON users FOR EACH ROW
+BEGIN
+  SET NEW.name = LOWER(NEW.name);
+END$$
+delimiter ;
+DROP TABLE tmp;
+`)
+	expected = []string{
+		"CREATE TRIGGER users_bi BEFORE INSERT ON users FOR EACH ROW\nBEGIN\n  SET NEW.name = LOWER(NEW.name);\nEND",
+		"DROP TABLE tmp",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %q Got: %q", expected, got)
+	}
+}
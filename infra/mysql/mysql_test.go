@@ -0,0 +1,206 @@
+package mysql_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/hifx/bingo/infra/mysql"
+	"github.com/hifx/bingo/infra/mysql/mysqltest"
+	"github.com/hifx/bingo/infra/retry"
+	"github.com/jmoiron/sqlx"
+	gometrics "github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context"
+)
+
+func open(opts ...mysql.Option) (*mysqltest.Fake, *mysql.RetryDB) {
+	f := mysqltest.New()
+	opts = append([]mysql.Option{mysql.WithRetries(2), mysql.WithBackoff(time.Millisecond)}, opts...)
+	return f, mysql.NewRetryDB(f.Open(), opts...)
+}
+
+func TestRetryDB(t *testing.T) {
+	f, db := open()
+	defer db.Close()
+
+	// transient errors are retried
+	f.On("UPDATE users").Times(2).Error(1213)
+	f.On("UPDATE users").Result(0, 1)
+	res, err := db.Exec("UPDATE users SET name = ? WHERE id = ?", "ada", 1)
+	if err != nil {
+		t.Fatal("Expected the deadlocks to be retried, Got:", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 || f.Count("UPDATE users") != 3 {
+		t.Error("Expected 1 row affected after 3 attempts, Got:", n, f.Count("UPDATE users"))
+	}
+
+	// the others are not
+	f.On("DELETE").Error(1064)
+	_, err = db.Exec("DELETE FROM")
+	if e, ok := err.(*gomysql.MySQLError); !ok || e.Number != 1064 || f.Count("DELETE") != 1 {
+		t.Error("Expected the syntax error after 1 attempt, Got:", err, f.Count("DELETE"))
+	}
+
+	// attempts run out
+	f.On("INSERT INTO users").Error(1213)
+	_, err = db.ExecContext(context.Background(), "INSERT INTO users (name) VALUES (?)", "ada")
+	if e, ok := err.(*retry.Error); !ok || e.Attempts != 3 || f.Count("INSERT INTO users") != 3 {
+		t.Error("Expected a *retry.Error after 3 attempts, Got:", err, f.Count("INSERT INTO users"))
+	}
+
+	// writes whose outcome is unknown are not retried, unless set otherwise
+	f.On("INSERT INTO orders").Error(2013)
+	_, err = db.ExecContext(context.Background(), "INSERT INTO orders (total) VALUES (?)", 10)
+	if e, ok := err.(*gomysql.MySQLError); !ok || e.Number != 2013 || f.Count("INSERT INTO orders") != 1 {
+		t.Error("Expected the lost connection after 1 attempt, Got:", err, f.Count("INSERT INTO orders"))
+	}
+	f, db = open(mysql.WithRetryAmbiguousWrites())
+	defer db.Close()
+	f.On("INSERT INTO orders").Error(2013)
+	_, err = db.ExecContext(context.Background(), "INSERT INTO orders (total) VALUES (?)", 10)
+	if e, ok := err.(*retry.Error); !ok || e.Attempts != 3 || f.Count("INSERT INTO orders") != 3 {
+		t.Error("Expected a *retry.Error after 3 attempts, Got:", err, f.Count("INSERT INTO orders"))
+	}
+}
+
+func TestRetryDBTimeout(t *testing.T) {
+	f, db := open(mysql.WithQueryTimeout(20 * time.Millisecond))
+	defer db.Close()
+
+	// slow attempts are cancelled and retried, on a new connection
+	f.On("SELECT name").Times(1).Delay(time.Second)
+	f.On("SELECT name").Rows([]string{"name"}, []driver.Value{"ada"})
+	var name string
+	start := time.Now()
+	if err := db.Get(&name, "SELECT name FROM users WHERE id = ?", 1); err != nil || name != "ada" {
+		t.Fatal("Expected: ada, Got:", name, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Error("Expected the slow attempt to be cancelled, took:", d)
+	}
+
+	// connections lost are replaced
+	f.On("SELECT id").Times(1).DropConnection()
+	f.On("SELECT id").Rows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	var ids []int64
+	if err := db.Select(&ids, "SELECT id FROM users"); err != nil || len(ids) != 2 || f.Count("SELECT id") != 2 {
+		t.Error("Expected 2 ids after 2 attempts, Got:", ids, err, f.Count("SELECT id"))
+	}
+
+	// the context of the caller stops the retries
+	f.On("SELECT email").Delay(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := db.GetContext(ctx, &name, "SELECT email FROM users WHERE id = ?", 1); err != context.DeadlineExceeded {
+		t.Error("Expected:", context.DeadlineExceeded, "Got:", err)
+	}
+}
+
+func TestRetryStmt(t *testing.T) {
+	f, db := open()
+	defer db.Close()
+
+	stmt, err := db.Preparex("UPDATE users SET name = ? WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	f.On("UPDATE users").Times(1).Error(1213)
+	if _, err := stmt.Exec("ada", 1); err != nil || f.Count("UPDATE users") != 2 {
+		t.Error("Expected success after 2 attempts, Got:", err, f.Count("UPDATE users"))
+	}
+	calls := f.Calls()
+	if args := calls[len(calls)-1].Args; len(args) != 2 || args[0] != "ada" || args[1] != int64(1) {
+		t.Error("Unexpected arguments:", args)
+	}
+	// the update may have been applied before the connection was lost
+	f.On("UPDATE users").Times(1).DropConnection()
+	if _, err := stmt.Exec("ada", 1); err != gomysql.ErrInvalidConn || f.Count("UPDATE users") != 3 {
+		t.Error("Expected:", gomysql.ErrInvalidConn, "after 1 attempt, Got:", err, f.Count("UPDATE users"))
+	}
+
+	named, err := db.PrepareNamed("SELECT name FROM users WHERE id = :id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer named.Close()
+	f.On("SELECT name").Times(1).Error(1205)
+	f.On("SELECT name").Times(1).Rows([]string{"name"}, []driver.Value{"ada"})
+	var name string
+	if err := named.Get(&name, map[string]interface{}{"id": 1}); err != nil || name != "ada" || f.Count("SELECT name") != 2 {
+		t.Error("Expected: ada after 2 attempts, Got:", name, err, f.Count("SELECT name"))
+	}
+	f.On("SELECT name").Error(1062)
+	if err := named.Get(&name, map[string]interface{}{"id": 1}); err == nil || f.Count("SELECT name") != 3 {
+		t.Error("Expected the duplicate entry error after 1 attempt, Got:", err, f.Count("SELECT name"))
+	}
+}
+
+func TestInTx(t *testing.T) {
+	f, db := open()
+	defer db.Close()
+
+	f.On("UPDATE accounts").Times(1).Error(1213)
+	runs := 0
+	err := db.InTx(context.Background(), nil, func(tx *sqlx.Tx) error {
+		runs++
+		_, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE id = ?", 10, 1)
+		return err
+	})
+	if err != nil || runs != 2 {
+		t.Fatal("Expected the deadlocked transaction to be run again, Got:", err, runs)
+	}
+	if f.Count(mysqltest.Begin) != 2 || f.Count(mysqltest.Rollback) != 1 || f.Count(mysqltest.Commit) != 1 {
+		t.Errorf("Unexpected statements: %+v", f.Calls())
+	}
+	if c := gometrics.DefaultRegistry.Get(`mysql_query_retries_total{op="transaction",query="transaction"}`); c == nil || c.(gometrics.Counter).Count() != 1 {
+		t.Error("Expected the retry to be counted under the transaction name, Got:", c)
+	}
+
+	// conflicts wrapped by fn run the transaction again too
+	f.Reset()
+	f.On("UPDATE accounts").Times(1).Error(1213)
+	runs = 0
+	err = db.InTx(context.Background(), nil, func(tx *sqlx.Tx) error {
+		runs++
+		if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE id = ?", 10, 1); err != nil {
+			return fmt.Errorf("debit: %w", err)
+		}
+		return nil
+	})
+	if err != nil || runs != 2 {
+		t.Error("Expected the wrapped deadlock to run the transaction again, Got:", err, runs)
+	}
+
+	// only conflicts run the transaction again
+	f.Reset()
+	f.On("UPDATE accounts").Error(1064)
+	runs = 0
+	err = db.InTx(context.Background(), &sql.TxOptions{}, func(tx *sqlx.Tx) error {
+		runs++
+		_, err := tx.Exec("UPDATE accounts SET")
+		return err
+	})
+	if e, ok := err.(*gomysql.MySQLError); !ok || e.Number != 1064 || runs != 1 || f.Count(mysqltest.Rollback) != 1 {
+		t.Error("Expected the syntax error after 1 run, Got:", err, runs)
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	var db *mysql.RetryDB
+	var name string
+	if err := db.QueryRowxContext(context.Background(), "SELECT name FROM users").Scan(&name); err == nil {
+		t.Error("Expected an error for a nil *RetryDB, Got:", err)
+	}
+	var stmt *mysql.RetryStmt
+	if err := stmt.QueryRowxContext(context.Background(), 1).Err(); err == nil {
+		t.Error("Expected an error for a nil *RetryStmt, Got:", err)
+	}
+	var named *mysql.RetryNamedStmt
+	if err := named.QueryRowxContext(context.Background(), nil).Err(); err == nil {
+		t.Error("Expected an error for a nil *RetryNamedStmt, Got:", err)
+	}
+}
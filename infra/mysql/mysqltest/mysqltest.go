@@ -0,0 +1,393 @@
+/*
+Package mysqltest provides a fake MySQL database to test code using database/sql offline.
+Its responses are scripted with rules: results, rows, latency, dropped connections and MySQL
+errors, for the statements matching them. The statements run are recorded to be checked.
+
+e.g. usage
+
+	f := mysqltest.New()
+	f.On("UPDATE accounts").Times(1).Error(1213) // a deadlock, then success
+	f.On("SELECT name").Rows([]string{"name"}, []driver.Value{"ada"})
+	db := mysql.NewRetryDB(f.Open(), mysql.WithRetries(2))
+	...
+	if f.Count("UPDATE accounts") != 2 {
+		t.Error("Expected the deadlock to be retried")
+	}
+*/
+package mysqltest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+// DriverName is the name the fake driver is registered with in database/sql
+const DriverName = "mysqltest"
+
+// The statements recorded for pings and transactions
+const (
+	Ping     = "PING"
+	Begin    = "BEGIN"
+	Commit   = "COMMIT"
+	Rollback = "ROLLBACK"
+)
+
+var (
+	mu    sync.Mutex
+	fakes = map[string]*Fake{}
+	seq   int
+)
+
+func init() {
+	sql.Register(DriverName, fakeDriver{})
+}
+
+// Call is a statement run on a Fake
+type Call struct {
+	Query string
+	Args  []driver.Value
+}
+
+// Fake is a fake database
+type Fake struct {
+	dsn   string
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+// New returns a new Fake, answering the statements not matching any rule with empty results
+func New() *Fake {
+	mu.Lock()
+	defer mu.Unlock()
+	seq++
+	f := &Fake{dsn: "fake" + strconv.Itoa(seq)}
+	fakes[f.dsn] = f
+	return f
+}
+
+// DSN returns the data source name to open f with, using DriverName
+func (f *Fake) DSN() string {
+	return f.dsn
+}
+
+// Open returns a database connected to f, using the MySQL flavour of sqlx
+func (f *Fake) Open() *sqlx.DB {
+	db, _ := sql.Open(DriverName, f.dsn)
+	return sqlx.NewDb(db, "mysql")
+}
+
+// On returns a new rule for the statements containing query, all of them if it is empty.
+// Rules are matched in the order they were added.
+func (f *Fake) On(query string) *Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := &Rule{query: query}
+	f.rules = append(f.rules, r)
+	return r
+}
+
+// Calls returns the statements run so far
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Count returns the number of statements run containing query
+func (f *Fake) Count(query string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if strings.Contains(c.Query, query) {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset drops the rules and the statements recorded
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules, f.calls = nil, nil
+}
+
+// Rule scripts the response to the statements matching it
+type Rule struct {
+	query   string
+	times   int
+	used    int
+	delay   time.Duration
+	err     error
+	drop    bool
+	columns []string
+	rows    [][]driver.Value
+	result  driver.Result
+}
+
+// Times limits the rule to the next n statements matching it. The rule applies to all of them by default.
+func (r *Rule) Times(n int) *Rule {
+	r.times = n
+	return r
+}
+
+// Delay makes the statements take d to complete, or until their context is done
+func (r *Rule) Delay(d time.Duration) *Rule {
+	r.delay = d
+	return r
+}
+
+// Error makes the statements fail with the MySQL error number, e.g. 1213 for a deadlock
+func (r *Rule) Error(number uint16) *Rule {
+	r.err = &mysql.MySQLError{Number: number, Message: "mysqltest: error " + strconv.Itoa(int(number))}
+	return r
+}
+
+// Fail makes the statements fail with err
+func (r *Rule) Fail(err error) *Rule {
+	r.err = err
+	return r
+}
+
+// DropConnection makes the statements fail with mysql.ErrInvalidConn, as the connection is
+// lost, and discards the connection they ran on
+func (r *Rule) DropConnection() *Rule {
+	r.err = mysql.ErrInvalidConn
+	r.drop = true
+	return r
+}
+
+// Rows makes the queries return rows with the given columns
+func (r *Rule) Rows(columns []string, rows ...[]driver.Value) *Rule {
+	r.columns, r.rows = columns, rows
+	return r
+}
+
+// Result makes the statements return the given last insert ID and number of rows affected
+func (r *Rule) Result(lastInsertID, rowsAffected int64) *Rule {
+	r.result = result{lastInsertID, rowsAffected}
+	return r
+}
+
+// match returns the rule for query, recording it, nil if there is none
+func (f *Fake) match(query string, args []driver.Value) *Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Query: query, Args: args})
+	for _, r := range f.rules {
+		if (r.times == 0 || r.used < r.times) && strings.Contains(query, r.query) {
+			r.used++
+			return r
+		}
+	}
+	return nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	mu.Lock()
+	f, ok := fakes[dsn]
+	mu.Unlock()
+	if !ok {
+		return nil, errors.New("mysqltest: unknown fake " + dsn)
+	}
+	return &conn{f: f}, nil
+}
+
+// conn is a connection to a Fake
+type conn struct {
+	f   *Fake
+	bad bool
+}
+
+// run plays the rule matching query
+func (c *conn) run(ctx context.Context, query string, args []driver.NamedValue) (*Rule, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	r := c.f.match(query, values)
+	if r == nil {
+		return nil, nil
+	}
+	if r.delay > 0 {
+		t := time.NewTimer(r.delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			// the MySQL driver kills the connection of the cancelled queries
+			c.bad = true
+			return nil, ctx.Err()
+		}
+	}
+	if r.drop {
+		c.bad = true
+	}
+	return r, r.err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || r.result == nil {
+		return result{}, nil
+	}
+	return r.result, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return &rows{}, nil
+	}
+	return &rows{columns: r.columns, rows: r.rows}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	_, err := c.run(ctx, Ping, nil)
+	return err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.run(ctx, Begin, nil); err != nil {
+		return nil, err
+	}
+	return tx{c}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	return &stmt{c: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+// ResetSession discards the connections lost
+func (c *conn) ResetSession(ctx context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// IsValid discards the connections lost
+func (c *conn) IsValid() bool {
+	return !c.bad
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t tx) Commit() error {
+	_, err := t.c.run(context.Background(), Commit, nil)
+	return err
+}
+
+func (t tx) Rollback() error {
+	_, err := t.c.run(context.Background(), Rollback, nil)
+	return err
+}
+
+// stmt is a prepared statement, played like the statements run directly
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+type result struct {
+	lastInsertID, rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
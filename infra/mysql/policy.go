@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/infra/retry"
+	"golang.org/x/net/context"
+)
+
+// MySQL error numbers worth retrying
+const (
+	erTooManyConnections = 1040
+	erServerShutdown     = 1053
+	erLockWaitTimeout    = 1205
+	erLockDeadlock       = 1213
+	crServerGone         = 2006
+	crServerLost         = 2013
+)
+
+// erParse is the MySQL error of a statement the server can't parse
+const erParse = 1064
+
+// retryPolicy holds the retry settings shared by RetryDB and its statements
+type retryPolicy struct {
+	policy        retry.Policy
+	slowLog       log.Logger    //logger of the slow queries
+	slowThreshold time.Duration //duration from which queries are slow
+	ambiguous     bool          //retry the writes whose outcome is unknown
+}
+
+func defaultRetryStrategy() retryPolicy {
+	return retryPolicy{policy: retry.Policy{
+		MaxAttempts:    3,
+		AttemptTimeout: 2 * time.Second,
+		Deadline:       3 * time.Second,
+		Retryable:      IsTransient,
+	}}
+}
+
+// Option configures the retries of a RetryDB
+type Option func(*retryPolicy)
+
+// WithRetries sets the number of retries after the first attempt. The writes failed on a lost
+// connection or a timed out attempt are not retried, as they may have been applied, unless
+// WithRetryAmbiguousWrites is set.
+func WithRetries(n int) Option {
+	return func(p *retryPolicy) {
+		p.policy.MaxAttempts = n + 1
+	}
+}
+
+// WithBackoff waits for d between attempts
+func WithBackoff(d time.Duration) Option {
+	return func(p *retryPolicy) {
+		p.policy.Delay = d
+		p.policy.Factor = 0
+	}
+}
+
+// WithExponentialBackoff waits for base before the first retry, multiplying the wait by factor
+// for every retry, up to max
+func WithExponentialBackoff(base time.Duration, factor int, max time.Duration) Option {
+	return func(p *retryPolicy) {
+		p.policy.Delay = base
+		p.policy.Factor = float64(factor)
+		p.policy.MaxDelay = max
+	}
+}
+
+// WithJitter randomizes the waits between attempts by +/- fraction of their duration, so that
+// clients failing together don't retry together
+func WithJitter(fraction float64) Option {
+	return func(p *retryPolicy) {
+		p.policy.Jitter = fraction
+	}
+}
+
+// WithQueryTimeout sets the time allowed for a single attempt
+func WithQueryTimeout(d time.Duration) Option {
+	return func(p *retryPolicy) {
+		p.policy.AttemptTimeout = d
+	}
+}
+
+// WithOverallDeadline sets the time allowed for all the attempts of a call
+func WithOverallDeadline(d time.Duration) Option {
+	return func(p *retryPolicy) {
+		p.policy.Deadline = d
+	}
+}
+
+// WithRetryAmbiguousWrites retries the writes failed on a lost connection or a timed out
+// attempt too, e.g. for idempotent statements. Those may have been applied before failing.
+func WithRetryAmbiguousWrites() Option {
+	return func(p *retryPolicy) {
+		p.ambiguous = true
+	}
+}
+
+// WithClassifier sets the function deciding which errors are retried. Defaults to IsTransient.
+func WithClassifier(retryable func(error) bool) Option {
+	return func(p *retryPolicy) {
+		p.policy.Retryable = retryable
+	}
+}
+
+// WithAttemptHook calls hook after every attempt of a call, e.g. to log the retries
+func WithAttemptHook(hook func(ctx context.Context, a retry.Attempt)) Option {
+	return func(p *retryPolicy) {
+		p.policy.OnAttempt = hook
+	}
+}
+
+// WithSlowQueryLog logs the calls taking threshold or more, retries included, to l along with
+// their request ID
+func WithSlowQueryLog(l log.Logger, threshold time.Duration) Option {
+	return func(p *retryPolicy) {
+		p.slowLog = l
+		p.slowThreshold = threshold
+	}
+}
+
+// IsTransient reports whether err is likely to go away on retry: deadlocks, lock wait timeouts,
+// lost connections and timed out attempts. Syntax errors, constraint violations and the like are not.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch e := err.(type) {
+	case *mysql.MySQLError:
+		switch e.Number {
+		case erLockDeadlock, erLockWaitTimeout, erTooManyConnections, erServerShutdown, crServerGone, crServerLost:
+			return true
+		}
+		return false
+	case net.Error:
+		return true
+	}
+	switch err {
+	case retry.ErrAttemptTimeout, driver.ErrBadConn, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	return false
+}
+
+// isAmbiguous reports whether err leaves the outcome of a statement unknown: the connection was
+// lost or the attempt timed out after the statement may have been sent
+func isAmbiguous(err error) bool {
+	switch e := err.(type) {
+	case *mysql.MySQLError:
+		return e.Number == crServerGone || e.Number == crServerLost
+	case net.Error:
+		return true
+	}
+	switch err {
+	case retry.ErrAttemptTimeout, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	return false
+}
+
+// policyOf returns the retry policy of the op calls. Writes failed ambiguously are not retried,
+// unless set otherwise.
+func (p *retryPolicy) policyOf(op string) retry.Policy {
+	policy := p.policy
+	if op != "exec" || p.ambiguous {
+		return policy
+	}
+	retryable := policy.Retryable
+	policy.Retryable = func(err error) bool {
+		return !isAmbiguous(err) && (retryable == nil || retryable(err))
+	}
+	return policy
+}
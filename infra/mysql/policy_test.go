@@ -0,0 +1,50 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/hifx/bingo/infra/retry"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}, false},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{driver.ErrBadConn, true},
+		{mysql.ErrInvalidConn, true},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{retry.ErrAttemptTimeout, true},
+		{errors.New("sql: no rows in result set"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := IsTransient(test.err); got != test.expected {
+			t.Error("Error:", test.err, "Expected:", test.expected, "Got:", got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	p := defaultRetryStrategy()
+	for _, o := range []Option{WithRetries(4), WithExponentialBackoff(10*time.Millisecond, 2, 50*time.Millisecond), WithQueryTimeout(time.Second), WithOverallDeadline(5 * time.Second)} {
+		o(&p)
+	}
+	if p.policy.MaxAttempts != 5 || p.policy.AttemptTimeout != time.Second || p.policy.Deadline != 5*time.Second {
+		t.Errorf("Unexpected policy: %+v", p.policy)
+	}
+	for attempt, expected := range []time.Duration{10, 20, 40, 50} {
+		if got := p.policy.Backoff(attempt + 1); got != expected*time.Millisecond {
+			t.Error("Attempt:", attempt+1, "Expected:", expected*time.Millisecond, "Got:", got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/infra/metrics"
+	"golang.org/x/net/context"
+)
+
+var (
+	poolOpen        = metrics.NewGauge("mysql_connections_open")
+	poolInUse       = metrics.NewGauge("mysql_connections_in_use")
+	poolIdle        = metrics.NewGauge("mysql_connections_idle")
+	poolMaxOpen     = metrics.NewGauge("mysql_connections_max_open")
+	poolWaits       = metrics.NewCounter("mysql_connections_waits_total")
+	poolWaitSeconds = metrics.NewGauge("mysql_connections_wait_seconds")
+	poolClosed      = metrics.NewCounter("mysql_connections_closed_total")
+
+	queryLatency = metrics.NewTimer("mysql_query_duration_seconds", nil)
+	queryRetries = metrics.NewCounter("mysql_query_retries_total")
+)
+
+// ExportStats publishes the stats of the connection pool of db every interval, labeled with
+// name, until the returned Closer is closed, e.g.
+//
+//	s := mysql.ExportStats("users", db.DB.DB, 10*time.Second)
+//	h := bingo.Wrap(m).AddCloser(s)
+func ExportStats(name string, db *sql.DB, interval time.Duration) io.Closer {
+	e := &statsExporter{db: db, labels: metrics.Labels{"db": name}, stop: make(chan struct{}), done: make(chan struct{})}
+	go e.loop(interval)
+	return e
+}
+
+type statsExporter struct {
+	db     *sql.DB
+	labels metrics.Labels
+	last   sql.DBStats
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (e *statsExporter) loop(interval time.Duration) {
+	defer close(e.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		e.export()
+		select {
+		case <-t.C:
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *statsExporter) export() {
+	s := e.db.Stats()
+	poolOpen.Set(e.labels, float64(s.OpenConnections))
+	poolInUse.Set(e.labels, float64(s.InUse))
+	poolIdle.Set(e.labels, float64(s.Idle))
+	poolMaxOpen.Set(e.labels, float64(s.MaxOpenConnections))
+	poolWaitSeconds.Set(e.labels, s.WaitDuration.Seconds())
+	// the stats are cumulative, the counters get what happened since the last export
+	poolWaits.Add(e.labels, s.WaitCount-e.last.WaitCount)
+	poolClosed.Add(metrics.Labels{"db": e.labels["db"], "reason": "max_idle"}, s.MaxIdleClosed-e.last.MaxIdleClosed)
+	poolClosed.Add(metrics.Labels{"db": e.labels["db"], "reason": "max_idle_time"}, s.MaxIdleTimeClosed-e.last.MaxIdleTimeClosed)
+	poolClosed.Add(metrics.Labels{"db": e.labels["db"], "reason": "max_lifetime"}, s.MaxLifetimeClosed-e.last.MaxLifetimeClosed)
+	e.last = s
+}
+
+// Close stops the export
+func (e *statsExporter) Close() error {
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+	return nil
+}
+
+const queryNameKey ctxKey = 1
+
+// WithQueryName returns a copy of ctx naming the query run with it, e.g. "get_user". The
+// timings and slow query logs of the query are keyed by the name instead of the fingerprint
+// of the query.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey, name)
+}
+
+// queryName returns the name of query, as per ctx or its fingerprint
+func queryName(ctx context.Context, query string) string {
+	if name, ok := ctx.Value(queryNameKey).(string); ok {
+		return name
+	}
+	return Fingerprint(query)
+}
+
+// Fingerprint returns query with its literals replaced by ?, lists of values collapsed and its
+// whitespace normalized, so that all the runs of a query share the same fingerprint, e.g.
+// "SELECT * FROM users WHERE id IN (1, 2, 3) AND name = 'x'" becomes
+// "SELECT * FROM users WHERE id IN (?+) AND name = ?"
+func Fingerprint(query string) string {
+	b := make([]byte, 0, len(query))
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if query[j] == '\\' {
+					j++
+				}
+			}
+			i = j
+			c = '?'
+		// a pending space separates the digit from the identifier before it, e.g. LIMIT 10
+		case c >= '0' && c <= '9' && (len(b) == 0 || space || !isIdent(b[len(b)-1])):
+			for i+1 < len(query) && (isIdent(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		case unicode.IsSpace(rune(c)):
+			space = true
+			continue
+		}
+		if space && len(b) > 0 && c != ')' && c != ',' && b[len(b)-1] != '(' {
+			b = append(b, ' ')
+		}
+		b = append(b, c)
+		// a comma is always followed by a single space
+		space = c == ','
+	}
+	s := strings.TrimSpace(string(b))
+	for strings.Contains(s, "?, ?") {
+		s = strings.Replace(s, "?, ?", "?", -1)
+	}
+	return strings.Replace(s, "(?)", "(?+)", -1)
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// run runs fn as per the retry policy, traced, timed, and logged if slow
+func (p *retryPolicy) run(ctx context.Context, op, query string, keep bool, fn func(context.Context) error) error {
+	start := time.Now()
+	var attempts int
+	err := Trace(ctx, op, query, func() (err error) {
+		policy := p.policyOf(op)
+		attempts, err = policy.Run(ctx, keep, fn)
+		return err
+	})
+	d := time.Since(start)
+
+	name := queryName(ctx, query)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	queryLatency.Observe(metrics.Labels{"op": op, "query": name, "status": status}, d)
+	if attempts > 1 {
+		queryRetries.Add(metrics.Labels{"op": op, "query": name}, int64(attempts-1))
+	}
+
+	if p.slowLog != nil && d >= p.slowThreshold {
+		l := p.slowLog.With("req_id", log.ReqID(ctx))
+		keyvals := []interface{}{
+			"type", "slow_query",
+			"op", op,
+			"query", name,
+			"duration", d.String(),
+			"attempts", attempts,
+		}
+		if err != nil {
+			keyvals = append(keyvals, "error", err.Error())
+		}
+		l.Warn(keyvals...)
+	}
+	return err
+}
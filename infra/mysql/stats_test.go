@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/infra/retry"
+	"golang.org/x/net/context"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query, expected string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users WHERE id=5", "SELECT * FROM users WHERE id=?"},
+		{"SELECT * FROM t LIMIT 10", "SELECT * FROM t LIMIT ?"},
+		{"SELECT * FROM t LIMIT 20 OFFSET 40", "SELECT * FROM t LIMIT ? OFFSET ?"},
+		{"SELECT * FROM t LIMIT 40, 20", "SELECT * FROM t LIMIT ?"},
+		{"SELECT col1, t2.x FROM t2", "SELECT col1, t2.x FROM t2"},
+		{"SELECT *\n\tFROM users\n\tWHERE id IN (1, 2,3) AND name = 'o\\'neil'", "SELECT * FROM users WHERE id IN (?+) AND name = ?"},
+		{"INSERT INTO t2 (a, b) VALUES (?, ?)", "INSERT INTO t2 (a, b) VALUES (?+)"},
+		{"UPDATE users SET score = -1.5 WHERE name = \"x\"", "UPDATE users SET score = -? WHERE name = ?"},
+	}
+	for _, test := range tests {
+		if got := Fingerprint(test.query); got != test.expected {
+			t.Errorf("Query: %q Expected: %q Got: %q", test.query, test.expected, got)
+		}
+	}
+}
+
+type warnings struct {
+	log.Logger
+	keyvals *[]interface{}
+}
+
+func (w warnings) With(keyvals ...interface{}) log.Logger {
+	*w.keyvals = append(*w.keyvals, keyvals...)
+	return w
+}
+
+func (w warnings) Warn(keyvals ...interface{}) { *w.keyvals = append(*w.keyvals, keyvals...) }
+
+func TestSlowQueryLog(t *testing.T) {
+	var logged, requestLogged []interface{}
+	p := defaultRetryStrategy()
+	WithSlowQueryLog(warnings{log.Discard, &logged}, 10*time.Millisecond)(&p)
+	WithBackoff(10 * time.Millisecond)(&p)
+
+	attempts := 0
+	ctx := context.WithValue(WithQueryName(context.Background(), "get_user"), log.ReqIDKey, "req-1")
+	ctx = log.NewContext(ctx, warnings{log.Discard, &requestLogged})
+	p.run(ctx, "get", "SELECT 1", false, func(ctx context.Context) error {
+		if attempts++; attempts == 1 {
+			return retry.ErrAttemptTimeout
+		}
+		return nil
+	})
+	// the slow queries go to the slow query log, rather than the logger of the request
+	expected := []interface{}{"req_id", "req-1", "type", "slow_query", "op", "get", "query", "get_user"}
+	if len(logged) != 12 || logged[11] != 2 || len(requestLogged) != 0 {
+		t.Fatal("Expected a slow query after 2 attempts, Got:", logged, requestLogged)
+	}
+	for i, v := range expected {
+		if logged[i] != v {
+			t.Error("Expected:", expected, "Got:", logged)
+		}
+	}
+}
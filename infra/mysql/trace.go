@@ -0,0 +1,17 @@
+package mysql
+
+import (
+	"github.com/hifx/bingo/infra/trace"
+	"golang.org/x/net/context"
+)
+
+// Trace runs fn, which runs query on the database, in a span child of the span in ctx, e.g.
+//
+//	err := mysql.Trace(ctx, "select", q, func() error {
+//		return db.Select(&users, q, id)
+//	})
+func Trace(ctx context.Context, op, query string, fn func() error) error {
+	return trace.Do(ctx, "mysql "+op, map[string]string{"db.system": "mysql", "db.operation": op, "db.statement": query}, func(context.Context) error {
+		return fn()
+	})
+}
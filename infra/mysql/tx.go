@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+// beginError is the error of a transaction that didn't start, safe to retry if transient
+type beginError struct {
+	err error
+}
+
+func (e beginError) Error() string {
+	return e.err.Error()
+}
+
+// isTxConflict reports whether err is a deadlock or a lock wait timeout, which abort the
+// transaction and are cured by running it again
+func isTxConflict(err error) bool {
+	var e *mysql.MySQLError
+	if errors.As(err, &e) {
+		return e.Number == erLockDeadlock || e.Number == erLockWaitTimeout
+	}
+	return false
+}
+
+// InTx runs fn in a transaction, committed if fn returns nil and rolled back if it returns an
+// error or panics. opts sets the isolation level and read-only mode, nil for the defaults of
+// the server. The whole of fn is run again, in a new transaction, on deadlocks and lock wait
+// timeouts, as many times as the retries of rdb allow, so fn must not have side effects outside
+// the transaction. The query timeout and the overall deadline of rdb don't apply, ctx bounds
+// the transaction. The transaction is timed under the name set with WithQueryName, or
+// "transaction". Use Savepoint to nest transactions in fn, e.g.
+//
+//	err := db.InTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead}, func(tx *sqlx.Tx) error {
+//		if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE id = ?", amount, from); err != nil {
+//			return err
+//		}
+//		_, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE id = ?", amount, to)
+//		return err
+//	})
+func (rdb *RetryDB) InTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) error {
+	if rdb == nil {
+		return errNotConnected
+	}
+	p := rdb.retryPolicy
+	p.policy.AttemptTimeout, p.policy.Deadline = 0, 0
+	p.policy.Retryable = func(err error) bool {
+		if b, ok := err.(beginError); ok {
+			return rdb.policy.Retryable == nil || rdb.policy.Retryable(b.err)
+		}
+		return isTxConflict(err)
+	}
+	if _, ok := ctx.Value(queryNameKey).(string); !ok {
+		ctx = WithQueryName(ctx, "transaction")
+	}
+	err := p.run(ctx, "transaction", "", false, func(ctx context.Context) error {
+		tx, err := rdb.DB.BeginTxx(ctx, opts)
+		if err != nil {
+			return beginError{err}
+		}
+		return runTx(tx, fn)
+	})
+	if b, ok := err.(beginError); ok {
+		return b.err
+	}
+	return err
+}
+
+// runTx runs fn in tx, committing or rolling back tx as per the outcome of fn
+func runTx(tx *sqlx.Tx, fn func(tx *sqlx.Tx) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+var savepoints uint64
+
+// Savepoint runs fn in a nested transaction of tx: the changes of fn are rolled back, leaving
+// the ones made before in tx alone, if fn returns an error or panics. Deadlocks abort the whole
+// of tx though, so their errors must be returned up to InTx to be retried.
+func Savepoint(tx *sqlx.Tx, fn func(tx *sqlx.Tx) error) (err error) {
+	name := "bingo_sp_" + strconv.FormatUint(atomic.AddUint64(&savepoints, 1), 10)
+	if _, err = tx.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+	_, err = tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
@@ -0,0 +1,447 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/hifx/bingo/infra/metrics"
+	"github.com/hifx/bingo/infra/retry"
+	"github.com/hifx/bingo/infra/trace"
+	"golang.org/x/net/context"
+)
+
+// ErrNil is returned by the helpers of Client reading a key or a field that doesn't exist
+var ErrNil = redis.ErrNil
+
+var (
+	commandLatency = metrics.NewTimer("redis_command_duration_seconds", nil)
+	commandRetries = metrics.NewCounter("redis_command_retries_total")
+)
+
+// Client runs commands on a connection pool with a deadline per call, latency metrics
+// labeled by command and retries on connection errors
+type Client struct {
+	Pool *redis.Pool
+	// Timeout bounds the wait for the replies of every attempt, on top of the deadline of the
+	// context of the call, if set. Commands in flight are not interrupted by their context being
+	// cancelled otherwise.
+	Timeout time.Duration
+	// Retry is the policy retrying the calls. Only the attempts failing before the command is
+	// sent, e.g. on dial errors, are retried, unless the context of the call is marked with
+	// Idempotent: a command whose reply was lost, e.g. INCRBY or RPOP, may have been applied.
+	Retry retry.Policy
+}
+
+// NewClient returns a client of pool with a timeout of a second, retrying the calls failed on
+// connection errors twice, as per Client.Retry
+func NewClient(pool *redis.Pool) *Client {
+	return &Client{
+		Pool:    pool,
+		Timeout: time.Second,
+		Retry: retry.Policy{
+			MaxAttempts: 3,
+			Delay:       10 * time.Millisecond,
+			Factor:      2,
+			MaxDelay:    100 * time.Millisecond,
+			Jitter:      0.2,
+			Retryable:   IsConnError,
+		},
+	}
+}
+
+// IsConnError reports whether err is a network error or a connection closed by the server,
+// rather than an error reply of the server
+func IsConnError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+type ctxKey int
+
+const idempotentKey ctxKey = 0
+
+// Idempotent returns a copy of ctx marking the calls made with it as safe to retry once their
+// command is sent, e.g. reads or SETs of a constant value, e.g.
+//
+//	v, err := client.Get(redis.Idempotent(ctx), "user:42")
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey).(bool)
+	return idempotent
+}
+
+// timeout returns the time left for an attempt as per ctx and c.Timeout, 0 for no limit
+func (c *Client) timeout(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	t := c.Timeout
+	if d, ok := ctx.Deadline(); ok {
+		left := time.Until(d)
+		if left <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+		if t <= 0 || left < t {
+			t = left
+		}
+	}
+	return t, nil
+}
+
+// run runs fn on a connection from the pool, retrying it as per c.Retry, in a span child of the
+// span in ctx. The calls are timed under the name cmd.
+func (c *Client) run(ctx context.Context, cmd string, fn func(conn redis.Conn, timeout time.Duration) error) error {
+	start := time.Now()
+	err := trace.Do(ctx, "redis "+cmd, map[string]string{"db.system": "redis", "db.operation": cmd}, func(ctx context.Context) error {
+		// sent is set once the attempt got a connection, from which point the command may
+		// have been applied
+		var sent bool
+		p := c.Retry
+		if !isIdempotent(ctx) {
+			p.Retryable = func(err error) bool {
+				return !sent && (c.Retry.Retryable == nil || c.Retry.Retryable(err))
+			}
+		}
+		attempts, err := p.Run(ctx, false, func(ctx context.Context) error {
+			sent = false
+			timeout, err := c.timeout(ctx)
+			if err != nil {
+				return err
+			}
+			conn := c.Pool.Get()
+			defer conn.Close()
+			if err := conn.Err(); err != nil {
+				return err
+			}
+			sent = true
+			return fn(conn, timeout)
+		})
+		if attempts > 1 {
+			commandRetries.Add(metrics.Labels{"command": cmd}, int64(attempts-1))
+		}
+		return err
+	})
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	commandLatency.ObserveSince(metrics.Labels{"command": cmd, "status": status}, start)
+	return err
+}
+
+// do runs the command on conn, waiting for timeout for its reply unless it is 0
+func do(conn redis.Conn, timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if timeout > 0 {
+		return redis.DoWithTimeout(conn, timeout, cmd, args...)
+	}
+	return conn.Do(cmd, args...)
+}
+
+// Do runs the command and returns its reply, e.g. c.Do(ctx, "INCRBY", "visits", 2)
+func (c *Client) Do(ctx context.Context, cmd string, args ...interface{}) (reply interface{}, err error) {
+	cmd = strings.ToUpper(cmd)
+	err = c.run(ctx, cmd, func(conn redis.Conn, timeout time.Duration) (err error) {
+		reply, err = do(conn, timeout, cmd, args...)
+		return err
+	})
+	return reply, err
+}
+
+// ttlArgs returns the arguments setting the expiry of a key to ttl, none if ttl is 0
+func ttlArgs(args []interface{}, ttl time.Duration) []interface{} {
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	return args
+}
+
+// Get returns the value of key, ErrNil if it doesn't exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "GET", key))
+}
+
+// GetBytes is Get, returning the value as bytes
+func (c *Client) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	return redis.Bytes(c.Do(ctx, "GET", key))
+}
+
+// Set sets key to value, expiring after ttl unless it is 0
+func (c *Client) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	_, err := c.Do(ctx, "SET", ttlArgs([]interface{}{key, value}, ttl)...)
+	return err
+}
+
+// SetNX is Set, only if key doesn't exist. It reports whether key was set.
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	_, err := redis.String(c.Do(ctx, "SET", append(ttlArgs([]interface{}{key, value}, ttl), "NX")...))
+	if err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Del deletes the keys and returns the number of keys deleted
+func (c *Client) Del(ctx context.Context, keys ...string) (int, error) {
+	return redis.Int(c.Do(ctx, "DEL", strArgs(nil, keys)...))
+}
+
+// Expire sets key to expire after ttl. It reports whether key exists.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return redis.Bool(c.Do(ctx, "PEXPIRE", key, int64(ttl/time.Millisecond)))
+}
+
+// Incr increments the integer value of key by n and returns the new value
+func (c *Client) Incr(ctx context.Context, key string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "INCRBY", key, n))
+}
+
+// HGet returns the value of the field of the hash at key, ErrNil if it doesn't exist
+func (c *Client) HGet(ctx context.Context, key, field string) (string, error) {
+	return redis.String(c.Do(ctx, "HGET", key, field))
+}
+
+// HSet sets the fields of the hash at key to their value in fields
+func (c *Client) HSet(ctx context.Context, key string, fields map[string]interface{}) error {
+	args := make([]interface{}, 0, 1+2*len(fields))
+	args = append(args, key)
+	for f, v := range fields {
+		args = append(args, f, v)
+	}
+	_, err := c.Do(ctx, "HSET", args...)
+	return err
+}
+
+// HGetAll returns the fields of the hash at key, none if it doesn't exist
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return redis.StringMap(c.Do(ctx, "HGETALL", key))
+}
+
+// HDel deletes the fields of the hash at key and returns the number of fields deleted
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) (int, error) {
+	return redis.Int(c.Do(ctx, "HDEL", strArgs([]interface{}{key}, fields)...))
+}
+
+// HIncr increments the integer value of the field of the hash at key by n and returns the new value
+func (c *Client) HIncr(ctx context.Context, key, field string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HINCRBY", key, field, n))
+}
+
+// LPush prepends the values to the list at key and returns the length of the list
+func (c *Client) LPush(ctx context.Context, key string, values ...interface{}) (int, error) {
+	return redis.Int(c.Do(ctx, "LPUSH", append([]interface{}{key}, values...)...))
+}
+
+// RPush appends the values to the list at key and returns the length of the list
+func (c *Client) RPush(ctx context.Context, key string, values ...interface{}) (int, error) {
+	return redis.Int(c.Do(ctx, "RPUSH", append([]interface{}{key}, values...)...))
+}
+
+// LPop removes and returns the first element of the list at key, ErrNil if it is empty
+func (c *Client) LPop(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "LPOP", key))
+}
+
+// RPop removes and returns the last element of the list at key, ErrNil if it is empty
+func (c *Client) RPop(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "RPOP", key))
+}
+
+// LRange returns the elements of the list at key from start to stop, included. Negative
+// indexes count from the end, e.g. LRange(ctx, key, 0, -1) returns the whole list.
+func (c *Client) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "LRANGE", key, start, stop))
+}
+
+// LLen returns the length of the list at key
+func (c *Client) LLen(ctx context.Context, key string) (int, error) {
+	return redis.Int(c.Do(ctx, "LLEN", key))
+}
+
+// Z is a member of a sorted set
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// ZAdd adds the members to the sorted set at key, updating the score of the existing ones, and
+// returns the number of members added
+func (c *Client) ZAdd(ctx context.Context, key string, members ...Z) (int, error) {
+	args := make([]interface{}, 0, 1+2*len(members))
+	args = append(args, key)
+	for _, m := range members {
+		args = append(args, m.Score, m.Member)
+	}
+	return redis.Int(c.Do(ctx, "ZADD", args...))
+}
+
+// ZIncr increments the score of member in the sorted set at key by n and returns the new score
+func (c *Client) ZIncr(ctx context.Context, key, member string, n float64) (float64, error) {
+	return redis.Float64(c.Do(ctx, "ZINCRBY", key, n, member))
+}
+
+// ZScore returns the score of member in the sorted set at key, ErrNil if it is not a member
+func (c *Client) ZScore(ctx context.Context, key, member string) (float64, error) {
+	return redis.Float64(c.Do(ctx, "ZSCORE", key, member))
+}
+
+// ZRem removes the members from the sorted set at key and returns the number of members removed
+func (c *Client) ZRem(ctx context.Context, key string, members ...string) (int, error) {
+	return redis.Int(c.Do(ctx, "ZREM", strArgs([]interface{}{key}, members)...))
+}
+
+// ZCard returns the number of members of the sorted set at key
+func (c *Client) ZCard(ctx context.Context, key string) (int, error) {
+	return redis.Int(c.Do(ctx, "ZCARD", key))
+}
+
+// ZRange returns the members of the sorted set at key, by ascending score, from the rank start to
+// stop, included. Negative ranks count from the end.
+func (c *Client) ZRange(ctx context.Context, key string, start, stop int) ([]Z, error) {
+	return zs(c.Do(ctx, "ZRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRevRange is ZRange, by descending score
+func (c *Client) ZRevRange(ctx context.Context, key string, start, stop int) ([]Z, error) {
+	return zs(c.Do(ctx, "ZREVRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// ZRangeByScore returns the members of the sorted set at key with a score between min and max,
+// by ascending score. The bounds are inclusive unless prefixed with "(", e.g. "(10", and may be
+// "-inf" or "+inf".
+func (c *Client) ZRangeByScore(ctx context.Context, key, min, max string) ([]Z, error) {
+	return zs(c.Do(ctx, "ZRANGEBYSCORE", key, min, max, "WITHSCORES"))
+}
+
+// zs converts a reply of member and score pairs to members
+func zs(reply interface{}, err error) ([]Z, error) {
+	values, err := redis.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Z, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, Z{Member: values[i], Score: score})
+	}
+	return members, nil
+}
+
+func strArgs(args []interface{}, values []string) []interface{} {
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+// Pipeline queues commands to send them at once, on the same connection
+type Pipeline struct {
+	c    *Client
+	cmds []command
+}
+
+type command struct {
+	name string
+	args []interface{}
+}
+
+// Pipeline returns an empty pipeline, e.g.
+//
+//	p := client.Pipeline()
+//	p.Send("INCR", "visits")
+//	p.Send("EXPIRE", "visits", 3600)
+//	replies, err := p.Exec(ctx)
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Send queues the command
+func (p *Pipeline) Send(cmd string, args ...interface{}) {
+	p.cmds = append(p.cmds, command{strings.ToUpper(cmd), args})
+}
+
+// Len returns the number of commands queued
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec sends the commands queued and returns their replies, in order. The error replies of the
+// server are returned as redis.Error replies, the error is that of the connection. The pipeline
+// is retried as a whole, as per Client.Retry, and is emptied afterwards.
+func (p *Pipeline) Exec(ctx context.Context) (replies []interface{}, err error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	err = p.c.run(ctx, "PIPELINE", func(conn redis.Conn, timeout time.Duration) error {
+		for _, cmd := range cmds {
+			if err := conn.Send(cmd.name, cmd.args...); err != nil {
+				return err
+			}
+		}
+		r, err := redis.Values(do(conn, timeout, ""))
+		if err != nil {
+			return err
+		}
+		replies = r
+		return nil
+	})
+	return replies, err
+}
+
+// Script is a Lua script run with EVALSHA, falling back to EVAL when the server doesn't have it
+// cached yet
+type Script struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewScript returns a script of src taking keyCount keys, e.g.
+//
+//	var incrMax = redis.NewScript(1, `
+//		local n = redis.call("INCR", KEYS[1])
+//		if n > tonumber(ARGV[1]) then
+//			redis.call("DECR", KEYS[1])
+//			return 0
+//		end
+//		return n`)
+//	n, err := redis.Int(client.Eval(ctx, incrMax, "slots", 10))
+func NewScript(keyCount int, src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{keyCount: keyCount, src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Hash returns the SHA1 digest of the script, as used by EVALSHA
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Eval runs the script with the keys then the arguments in keysAndArgs and returns its reply
+func (c *Client) Eval(ctx context.Context, s *Script, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	args := make([]interface{}, 0, 2+len(keysAndArgs))
+	args = append(args, s.hash, s.keyCount)
+	args = append(args, keysAndArgs...)
+	err = c.run(ctx, "EVALSHA", func(conn redis.Conn, timeout time.Duration) (err error) {
+		reply, err = do(conn, timeout, "EVALSHA", args...)
+		if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "NOSCRIPT") {
+			reply, err = do(conn, timeout, "EVAL", append([]interface{}{s.src}, args[1:]...)...)
+		}
+		return err
+	})
+	return reply, err
+}
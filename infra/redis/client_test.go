@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context"
+)
+
+// fakeConn answers the commands with handle, recording them along with their timeout
+type fakeConn struct {
+	handle   func(cmd string, args []interface{}) (interface{}, error)
+	calls    *[]string
+	timeouts *[]time.Duration
+	pending  []command
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, command{cmd, args})
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	return nil, errors.New("unexpected Receive")
+}
+
+func (c *fakeConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Receive()
+}
+
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, cmd, args...)
+}
+
+func (c *fakeConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" && len(c.pending) == 0 {
+		return nil, nil
+	}
+	*c.timeouts = append(*c.timeouts, timeout)
+	if cmd == "" {
+		replies := make([]interface{}, len(c.pending))
+		for i, p := range c.pending {
+			*c.calls = append(*c.calls, p.name)
+			r, err := c.handle(p.name, p.args)
+			if err != nil {
+				r = err
+			}
+			replies[i] = r
+		}
+		c.pending = nil
+		return replies, nil
+	}
+	*c.calls = append(*c.calls, cmd)
+	return c.handle(cmd, args)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func fakeClient(handle func(cmd string, args []interface{}) (interface{}, error)) (*Client, *[]string, *[]time.Duration) {
+	calls, timeouts := &[]string{}, &[]time.Duration{}
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) {
+		return &fakeConn{handle: handle, calls: calls, timeouts: timeouts}, nil
+	}}
+	c := NewClient(pool)
+	c.Retry.Delay = time.Millisecond
+	return c, calls, timeouts
+}
+
+func TestClient(t *testing.T) {
+	failures, dialFailures := 2, 0
+	c, calls, _ := fakeClient(func(cmd string, args []interface{}) (interface{}, error) {
+		switch cmd {
+		case "GET":
+			if failures > 0 {
+				failures--
+				return nil, io.EOF
+			}
+			return []byte("v"), nil
+		case "HGET":
+			return nil, nil
+		case "INCRBY":
+			return nil, io.EOF
+		case "SET":
+			return nil, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+		case "ZRANGE":
+			return []interface{}{[]byte("a"), []byte("1"), []byte("b"), []byte("2.5")}, nil
+		}
+		return nil, errors.New("unexpected command " + cmd)
+	})
+	dial := c.Pool.Dial
+	c.Pool.Dial = func() (redis.Conn, error) {
+		if dialFailures > 0 {
+			dialFailures--
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		}
+		return dial()
+	}
+	ctx := context.Background()
+
+	// connection errors are retried for the calls marked idempotent
+	if v, err := c.Get(Idempotent(ctx), "k"); err != nil || v != "v" || len(*calls) != 3 {
+		t.Error("Expected: v after 3 attempts, Got:", v, err, *calls)
+	}
+	if n := metrics.DefaultRegistry.Get(`redis_command_retries_total{command="GET"}`); n == nil || n.(metrics.Counter).Count() != 2 {
+		t.Error("Expected 2 retries to be counted, Got:", n)
+	}
+
+	// and only before the command is sent for the others
+	*calls = nil
+	if _, err := c.Incr(ctx, "k", 2); err != io.EOF || len(*calls) != 1 {
+		t.Error("Expected:", io.EOF, "after 1 attempt, Got:", err, *calls)
+	}
+	*calls, dialFailures = nil, 2
+	if _, err := c.Incr(ctx, "k", 2); err != io.EOF || len(*calls) != 1 || dialFailures != 0 {
+		t.Error("Expected the dial errors to be retried, Got:", err, *calls, dialFailures)
+	}
+
+	// the error replies are not
+	*calls = nil
+	if err := c.Set(ctx, "k", "v", time.Minute); err == nil || len(*calls) != 1 {
+		t.Error("Expected the error reply after 1 attempt, Got:", err, *calls)
+	}
+
+	if _, err := c.HGet(ctx, "h", "f"); err != ErrNil {
+		t.Error("Expected:", ErrNil, "Got:", err)
+	}
+
+	expected := []Z{{"a", 1}, {"b", 2.5}}
+	if members, err := c.ZRange(ctx, "z", 0, -1); err != nil || !reflect.DeepEqual(members, expected) {
+		t.Error("Expected:", expected, "Got:", members, err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	c, calls, timeouts := fakeClient(func(cmd string, args []interface{}) (interface{}, error) {
+		return nil, timeoutError{}
+	})
+	c.Timeout = 50 * time.Millisecond
+
+	_, err := c.Do(context.Background(), "get", "k")
+	if err != (timeoutError{}) || (*timeouts)[0] != 50*time.Millisecond || (*calls)[0] != "GET" {
+		t.Error("Expected the timeout of the client to apply, Got:", err, *timeouts, *calls)
+	}
+
+	// the deadline of the context applies when closer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Do(ctx, "GET", "k")
+	if d := (*timeouts)[1]; d <= 0 || d > 10*time.Millisecond {
+		t.Error("Expected the deadline of the context to apply, Got:", d)
+	}
+	<-ctx.Done()
+	if _, err := c.Do(ctx, "GET", "k"); err != context.DeadlineExceeded || len(*calls) != 2 {
+		t.Error("Expected:", context.DeadlineExceeded, "without running the command, Got:", err, *calls)
+	}
+}
+
+func TestPipelineAndScript(t *testing.T) {
+	script := NewScript(1, "return redis.call('INCR', KEYS[1])")
+	loaded := false
+	c, calls, _ := fakeClient(func(cmd string, args []interface{}) (interface{}, error) {
+		switch cmd {
+		case "SET":
+			return "OK", nil
+		case "GET":
+			return []byte("v"), nil
+		case "INCR":
+			return nil, redis.Error("WRONGTYPE")
+		case "EVALSHA":
+			if !loaded || args[0] != script.Hash() {
+				return nil, redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+			}
+			return int64(2), nil
+		case "EVAL":
+			if args[0] != script.src || args[1] != 1 || args[2] != "counter" {
+				return nil, errors.New("unexpected arguments")
+			}
+			loaded = true
+			return int64(1), nil
+		}
+		return nil, errors.New("unexpected command " + cmd)
+	})
+	ctx := context.Background()
+
+	p := c.Pipeline()
+	p.Send("set", "k", "v")
+	p.Send("GET", "k")
+	p.Send("INCR", "k")
+	replies, err := p.Exec(ctx)
+	if err != nil || len(replies) != 3 || replies[0] != "OK" || string(replies[1].([]byte)) != "v" || replies[2] != redis.Error("WRONGTYPE") {
+		t.Error("Unexpected replies:", replies, err)
+	}
+	if p.Len() != 0 {
+		t.Error("Expected the pipeline to be emptied")
+	}
+
+	for _, expected := range []int{1, 2} {
+		if n, err := redis.Int(c.Eval(ctx, script, "counter")); err != nil || n != expected {
+			t.Error("Expected:", expected, "Got:", n, err)
+		}
+	}
+	if s := strings.Join((*calls)[3:], " "); s != "EVALSHA EVAL EVALSHA" {
+		t.Error("Expected EVALSHA to fall back to EVAL once, Got:", s)
+	}
+}
@@ -1,5 +1,20 @@
 /*
 Package redis provides the library to communicate to redis
+
+e.g. usage
+
+	pool, err := redis.Connect("localhost:6379", 20, 10)
+	...
+	client := redis.NewClient(pool)
+	func handler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		// the call gives up when the request does, or after client.Timeout, and being a
+		// read, it is retried on connection errors
+		name, err := client.Get(redis.Idempotent(ctx), "user:"+id)
+		if err == redis.ErrNil {
+			...
+		}
+		...
+	}
 */
 package redis
 
@@ -0,0 +1,12 @@
+package redis
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"golang.org/x/net/context"
+)
+
+// Do runs the command on a connection from the pool, in a span child of the span in ctx. It is
+// the Do of a Client of pool without timeout nor retries.
+func Do(ctx context.Context, pool *redis.Pool, cmd string, args ...interface{}) (interface{}, error) {
+	return (&Client{Pool: pool}).Do(ctx, cmd, args...)
+}
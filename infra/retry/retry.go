@@ -0,0 +1,210 @@
+/*
+Package retry runs operations until they succeed, retrying the failed attempts as per a Policy:
+bounded attempts with a backoff between them, a timeout per attempt enforced by cancelling its
+context, an overall deadline, a classifier of the errors worth retrying and hooks observing the
+attempts.
+
+e.g. usage
+
+	p := retry.Policy{
+		MaxAttempts:    3,
+		Delay:          50 * time.Millisecond,
+		Factor:         2,
+		MaxDelay:       time.Second,
+		Jitter:         0.2,
+		AttemptTimeout: 500 * time.Millisecond,
+		Retryable:      isTemporary,
+	}
+	err := p.Do(ctx, func(ctx context.Context) error {
+		return call(ctx)
+	})
+*/
+package retry
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrAttemptTimeout is the error of an attempt that didn't complete within the attempt timeout
+var ErrAttemptTimeout = errors.New("retry: attempt timed out")
+
+// Policy configures the retries of an operation. The zero Policy makes a single attempt.
+type Policy struct {
+	// MaxAttempts is the number of attempts, including the first
+	MaxAttempts int
+	// Delay is the wait before the first retry
+	Delay time.Duration
+	// Factor multiplies the wait for every retry after the first. Waits are constant if it is <= 1.
+	Factor float64
+	// MaxDelay caps the wait between attempts, if set
+	MaxDelay time.Duration
+	// Jitter randomizes the waits by +/- Jitter of their duration, so that clients failing
+	// together don't retry together
+	Jitter float64
+	// AttemptTimeout is the time allowed for an attempt, if set. The context of the attempt is
+	// cancelled afterwards and it fails with ErrAttemptTimeout.
+	AttemptTimeout time.Duration
+	// Deadline is the time allowed for all the attempts, if set
+	Deadline time.Duration
+	// Retryable decides which errors are retried. All of them are if it is nil.
+	Retryable func(error) bool
+	// OnAttempt, if set, is called after every attempt
+	OnAttempt func(ctx context.Context, a Attempt)
+}
+
+// Attempt is the outcome of an attempt
+type Attempt struct {
+	// N is the number of the attempt, 1 being the first
+	N int
+	// Err is the error of the attempt, nil if it succeeded
+	Err error
+	// Duration is the time the attempt took
+	Duration time.Duration
+	// Retry is set if the attempt failed and is to be retried
+	Retry bool
+}
+
+// Error is the error of an operation whose attempts all failed with errors worth retrying
+type Error struct {
+	// Attempts is the number of attempts made
+	Attempts int
+	// Last is the error of the last attempt
+	Last error
+	// Expired is set if the deadline stopped the retries, rather than the number of attempts
+	Expired bool
+}
+
+func (e *Error) Error() string {
+	if e.Expired {
+		return "retry: deadline expired after " + strconv.Itoa(e.Attempts) + " attempts, last error: " + e.Last.Error()
+	}
+	return "retry: " + strconv.Itoa(e.Attempts) + " attempts failed, last error: " + e.Last.Error()
+}
+
+// Unwrap returns the error of the last attempt
+func (e *Error) Unwrap() error {
+	return e.Last
+}
+
+// Backoff returns the wait after the attempt n, 1 being the first
+func (p *Policy) Backoff(n int) time.Duration {
+	d := float64(p.Delay)
+	if p.Factor > 1 {
+		d *= math.Pow(p.Factor, float64(n-1))
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		j := d * p.Jitter
+		d = d - j + rand.Float64()*2*j
+	}
+	return time.Duration(d)
+}
+
+// Do runs fn until it succeeds, fails with an error not worth retrying, or the attempts, the
+// deadline or ctx run out. It returns nil, the error not worth retrying, the error of ctx, or
+// an *Error.
+func (p *Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := p.Run(ctx, false, fn)
+	return err
+}
+
+// Run is Do, returning the number of attempts made too. With keep, the context of the
+// successful attempt is not cancelled, as what it returned, e.g. database rows, may depend on it;
+// it is done along with ctx.
+func (p *Policy) Run(ctx context.Context, keep bool, fn func(ctx context.Context) error) (attempts int, err error) {
+	var deadline time.Time
+	if p.Deadline > 0 {
+		deadline = time.Now().Add(p.Deadline)
+	}
+	max := p.MaxAttempts
+	if max < 1 {
+		max = 1
+	}
+	for attempts = 1; ; attempts++ {
+		timeout := p.AttemptTimeout
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return attempts - 1, &Error{Attempts: attempts - 1, Last: err, Expired: true}
+			}
+			if timeout <= 0 || left < timeout {
+				timeout = left
+			}
+		}
+		actx, cancel := ctx, func() {}
+		var t *time.Timer
+		if timeout > 0 {
+			actx, cancel = context.WithCancel(ctx)
+			t = time.AfterFunc(timeout, cancel)
+		}
+
+		start := time.Now()
+		err = fn(actx)
+		timedOut := t != nil && !t.Stop()
+		a := Attempt{N: attempts, Err: err, Duration: time.Since(start)}
+		if err == nil {
+			if !keep {
+				cancel()
+			}
+			p.observe(ctx, a)
+			return attempts, nil
+		}
+		cancel()
+		if ctx.Err() != nil {
+			p.observe(ctx, a)
+			return attempts, err
+		}
+		if timedOut {
+			err = ErrAttemptTimeout
+			a.Err = err
+		}
+		if p.Retryable != nil && !p.Retryable(err) {
+			p.observe(ctx, a)
+			return attempts, err
+		}
+		if attempts >= max {
+			p.observe(ctx, a)
+			return attempts, &Error{Attempts: attempts, Last: err}
+		}
+
+		d := p.Backoff(attempts)
+		if !deadline.IsZero() && time.Now().Add(d).After(deadline) {
+			p.observe(ctx, a)
+			return attempts, &Error{Attempts: attempts, Last: err, Expired: true}
+		}
+		a.Retry = true
+		p.observe(ctx, a)
+		if serr := sleep(ctx, d); serr != nil {
+			return attempts, serr
+		}
+	}
+}
+
+func (p *Policy) observe(ctx context.Context, a Attempt) {
+	if p.OnAttempt != nil {
+		p.OnAttempt(ctx, a)
+	}
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
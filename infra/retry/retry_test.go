@@ -0,0 +1,108 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	errTemporary = errors.New("temporary")
+	errPermanent = errors.New("permanent")
+)
+
+func TestRun(t *testing.T) {
+	var observed []Attempt
+	p := Policy{
+		MaxAttempts:    3,
+		Delay:          time.Millisecond,
+		AttemptTimeout: 20 * time.Millisecond,
+		Retryable:      func(err error) bool { return err != errPermanent },
+		OnAttempt:      func(ctx context.Context, a Attempt) { observed = append(observed, a) },
+	}
+
+	// timed out attempts are cancelled and retried
+	n, err := p.Run(context.Background(), false, func(ctx context.Context) error {
+		if len(observed) == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if err != nil || n != 2 || len(observed) != 2 || observed[0].Err != ErrAttemptTimeout || !observed[0].Retry || observed[1].Err != nil {
+		t.Errorf("Expected success on the second attempt, Got: %v %d %+v", err, n, observed)
+	}
+
+	// errors not worth retrying are returned as is
+	observed = nil
+	n, err = p.Run(context.Background(), false, func(ctx context.Context) error {
+		return errPermanent
+	})
+	if err != errPermanent || n != 1 {
+		t.Error("Expected:", errPermanent, "after 1 attempt, Got:", err, n)
+	}
+
+	// attempts run out
+	n, err = p.Run(context.Background(), false, func(ctx context.Context) error {
+		return errTemporary
+	})
+	if e, ok := err.(*Error); !ok || e.Attempts != 3 || e.Last != errTemporary || e.Unwrap() != errTemporary || e.Expired || n != 3 {
+		t.Error("Expected an *Error after 3 attempts, Got:", err, n)
+	}
+
+	// the context of the caller stops the retries
+	ctx, cancel := context.WithCancel(context.Background())
+	n, err = p.Run(ctx, false, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if err != context.Canceled || n != 1 {
+		t.Error("Expected:", context.Canceled, "after 1 attempt, Got:", err, n)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	p := Policy{MaxAttempts: 10, Delay: 40 * time.Millisecond, Deadline: 60 * time.Millisecond}
+	n, err := p.Run(context.Background(), false, func(ctx context.Context) error {
+		return errTemporary
+	})
+	if e, ok := err.(*Error); !ok || !e.Expired || n != 2 {
+		t.Error("Expected the deadline to expire after 2 attempts, Got:", err, n)
+	}
+}
+
+func TestRunKeep(t *testing.T) {
+	p := Policy{AttemptTimeout: time.Second}
+	var actx context.Context
+	p.Run(context.Background(), true, func(ctx context.Context) error {
+		actx = ctx
+		return nil
+	})
+	if actx.Err() != nil {
+		t.Error("Expected the context of the successful attempt to be kept")
+	}
+	p.Run(context.Background(), false, func(ctx context.Context) error {
+		actx = ctx
+		return nil
+	})
+	if actx.Err() == nil {
+		t.Error("Expected the context of the attempt to be cancelled")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Delay: 10 * time.Millisecond, Factor: 2, MaxDelay: 50 * time.Millisecond}
+	for n, expected := range []time.Duration{10, 20, 40, 50} {
+		if got := p.Backoff(n + 1); got != expected*time.Millisecond {
+			t.Error("Attempt:", n+1, "Expected:", expected*time.Millisecond, "Got:", got)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(1); d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatal("Backoff out of the jitter range:", d)
+		}
+	}
+}
@@ -1,5 +1,17 @@
 /*
 Package solr provides the library to communicate to solr
+
+e.g. usage
+
+	c, err := solr.Connect("http://localhost:8983/solr", "articles")
+	...
+	func handler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		q := gosolr.NewQuery()
+		q.Q("title:" + term)
+		// the search is traced in a span child of the request's
+		res, err := c.Search(ctx, q)
+		...
+	}
 */
 package solr
 
@@ -9,10 +21,16 @@ import (
 	"github.com/hifx/go-solr/solr"
 )
 
+// Client is a solr core whose searches and updates take a context and are traced. The methods
+// of the embedded SolrInterface it doesn't override can be traced with Trace.
+type Client struct {
+	*solr.SolrInterface
+}
+
 // Connect initializes the solr connection object
 // Note: this doesn't actually hold a connection, its just
 // a container for the URL
-func Connect(host string, core string) (*solr.SolrInterface, error) {
+func Connect(host string, core string) (*Client, error) {
 	si, _ := solr.NewSolrInterface(host, core)
 	status, qtime, _ := si.Ping()
 	if status != "OK" {
@@ -21,5 +39,5 @@ func Connect(host string, core string) (*solr.SolrInterface, error) {
 	if qtime < 0 {
 		return nil, fmt.Errorf("unable to connect to solr '%s/%s' qtime expected to be larger than '-1' but got '%d'", host, core, qtime)
 	}
-	return si, nil
+	return &Client{si}, nil
 }
@@ -0,0 +1,57 @@
+package solr
+
+import (
+	"net/url"
+
+	"github.com/hifx/bingo/infra/trace"
+	"github.com/hifx/go-solr/solr"
+	"golang.org/x/net/context"
+)
+
+// Trace runs fn, which queries solr, in a span child of the span in ctx, e.g.
+//
+//	err := solr.Trace(ctx, "schema", func() error {
+//		schema, err = c.Schema()
+//		return err
+//	})
+func Trace(ctx context.Context, op string, fn func() error) error {
+	return trace.Do(ctx, "solr "+op, map[string]string{"db.system": "solr", "db.operation": op}, func(context.Context) error {
+		return fn()
+	})
+}
+
+// Search runs q and returns its result
+func (c *Client) Search(ctx context.Context, q *solr.Query) (res *solr.SolrResult, err error) {
+	err = Trace(ctx, "select", func() error {
+		res, err = c.SolrInterface.Search(q).Result(nil)
+		return err
+	})
+	return res, err
+}
+
+// Add adds the documents, in chunks of chunkSize documents
+func (c *Client) Add(ctx context.Context, docs []solr.Document, chunkSize int, params *url.Values) (res *solr.SolrUpdateResponse, err error) {
+	err = Trace(ctx, "add", func() error {
+		res, err = c.SolrInterface.Add(docs, chunkSize, params)
+		return err
+	})
+	return res, err
+}
+
+// Delete deletes the documents matching data, e.g. {"query": "id:42"}
+func (c *Client) Delete(ctx context.Context, data map[string]interface{}, params *url.Values) (res *solr.SolrUpdateResponse, err error) {
+	err = Trace(ctx, "delete", func() error {
+		res, err = c.SolrInterface.Delete(data, params)
+		return err
+	})
+	return res, err
+}
+
+// Commit commits the pending updates
+func (c *Client) Commit(ctx context.Context) (res *solr.SolrUpdateResponse, err error) {
+	err = Trace(ctx, "commit", func() error {
+		res, err = c.SolrInterface.Commit()
+		return err
+	})
+	return res, err
+}
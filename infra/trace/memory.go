@@ -0,0 +1,40 @@
+package trace
+
+import "sync"
+
+// InMemory is an Exporter keeping the spans in memory, for tests
+type InMemory struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemory returns an empty InMemory exporter
+func NewInMemory() *InMemory {
+	return &InMemory{}
+}
+
+// Export records s
+func (m *InMemory) Export(s SpanData) {
+	m.mu.Lock()
+	m.spans = append(m.spans, s)
+	m.mu.Unlock()
+}
+
+// Spans returns the spans exported, in the order they finished
+func (m *InMemory) Spans() []SpanData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SpanData(nil), m.spans...)
+}
+
+// Reset removes the recorded spans
+func (m *InMemory) Reset() {
+	m.mu.Lock()
+	m.spans = nil
+	m.mu.Unlock()
+}
+
+// Close does nothing
+func (m *InMemory) Close() error {
+	return nil
+}
@@ -0,0 +1,259 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hifx/bingo/infra/metrics"
+)
+
+// DefaultOTLPEndpoint is the traces endpoint of a local OpenTelemetry collector
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// droppedSpans counts the spans not exported, labeled by reason: "queue_full" or "closed"
+var droppedSpans = metrics.NewCounter("trace_spans_dropped_total")
+
+// OTLP is an Exporter sending the spans in batches to an OpenTelemetry collector,
+// as JSON over HTTP
+type OTLP struct {
+	// BatchSize is the number of spans after which a batch is sent. Defaults to 512.
+	BatchSize int
+	// MaxQueue is the number of spans kept while the collector is unreachable; newer spans
+	// are dropped. Defaults to 2048.
+	MaxQueue int
+	// Interval is the time after which pending spans are sent. Defaults to 5s.
+	Interval time.Duration
+	// Client sends the batches. Defaults to a client with a 10s timeout.
+	Client *http.Client
+
+	endpoint string
+	service  string
+
+	mu      sync.Mutex
+	pending []SpanData
+	dropped int
+	closed  bool
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	start   sync.Once
+}
+
+// NewOTLP returns an OTLP exporter sending to endpoint, DefaultOTLPEndpoint if empty,
+// with service as the service.name of the spans
+func NewOTLP(endpoint, service string) *OTLP {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	return &OTLP{
+		endpoint: endpoint,
+		service:  service,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Export queues s, to be sent with the next batch. Spans exported once o is closed are dropped.
+func (o *OTLP) Export(s SpanData) {
+	o.start.Do(o.init)
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		droppedSpans.Inc(metrics.Labels{"reason": "closed"})
+		return
+	}
+	if len(o.pending) >= o.MaxQueue {
+		o.dropped++
+		o.mu.Unlock()
+		droppedSpans.Inc(metrics.Labels{"reason": "queue_full"})
+		return
+	}
+	o.pending = append(o.pending, s)
+	full := len(o.pending) >= o.BatchSize
+	o.mu.Unlock()
+	if full {
+		select {
+		case o.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (o *OTLP) init() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 512
+	}
+	if o.MaxQueue <= 0 {
+		o.MaxQueue = 2048
+	}
+	if o.Interval <= 0 {
+		o.Interval = 5 * time.Second
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	go o.loop()
+}
+
+func (o *OTLP) loop() {
+	defer close(o.done)
+	t := time.NewTicker(o.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-o.flush:
+		case <-o.stop:
+			o.send()
+			return
+		}
+		o.send()
+	}
+}
+
+// send sends the pending spans in batches. Spans are kept for the next attempt if the collector fails.
+func (o *OTLP) send() {
+	for {
+		o.mu.Lock()
+		n := len(o.pending)
+		if n > o.BatchSize {
+			n = o.BatchSize
+		}
+		batch := o.pending[:n]
+		dropped := o.dropped
+		o.dropped = 0
+		o.mu.Unlock()
+
+		if dropped > 0 {
+			log.Printf("trace: dropped %d spans, the collector at %s is too slow", dropped, o.endpoint)
+		}
+		if n == 0 {
+			return
+		}
+		if err := o.post(batch); err != nil {
+			log.Println("trace: unable to export spans:", err)
+			return
+		}
+		o.mu.Lock()
+		o.pending = append([]SpanData(nil), o.pending[n:]...)
+		o.mu.Unlock()
+	}
+}
+
+func (o *OTLP) post(spans []SpanData) error {
+	d, err := json.Marshal(o.request(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := o.Client.Post(o.endpoint, "application/json", bytes.NewReader(d))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Close sends the pending spans and stops the exporter
+func (o *OTLP) Close() error {
+	o.start.Do(o.init)
+	o.once.Do(func() {
+		o.mu.Lock()
+		o.closed = true
+		o.mu.Unlock()
+		close(o.stop)
+	})
+	<-o.done
+	return nil
+}
+
+// The OTLP/JSON encoding of ExportTraceServiceRequest
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		TraceState        string          `json:"traceState,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// otlpStatusError is the STATUS_CODE_ERROR of OTLP
+const otlpStatusError = 2
+
+func (o *OTLP) request(spans []SpanData) otlpRequest {
+	ss := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		sp := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			TraceState:        s.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentID.IsValid() {
+			sp.ParentSpanID = s.ParentID.String()
+		}
+		for k, v := range s.Attributes {
+			sp.Attributes = append(sp.Attributes, otlpAttribute{k, otlpValue{v}})
+		}
+		if s.Err != "" {
+			sp.Status = otlpStatus{Code: otlpStatusError, Message: s.Err}
+		}
+		ss[i] = sp
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{"service.name", otlpValue{o.service}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/hifx/bingo/infra/trace"},
+			Spans: ss,
+		}},
+	}}}
+}
@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// W3C trace context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// maxTracestate is the length above which a tracestate is dropped rather than propagated
+const maxTracestate = 512
+
+// Extract returns the span context carried by the traceparent and tracestate headers of h
+func Extract(h http.Header) (SpanContext, bool) {
+	tp := h.Get(TraceparentHeader)
+	if tp == "" {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(strings.TrimSpace(tp))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if ts := strings.Join(h[http.CanonicalHeaderKey(TracestateHeader)], ","); len(ts) <= maxTracestate {
+		sc.TraceState = ts
+	}
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers of h from the span in ctx
+func Inject(ctx context.Context, h http.Header) {
+	s := FromContext(ctx)
+	if s == nil {
+		return
+	}
+	sc := s.Context()
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Package trace provides distributed tracing with W3C trace context propagation
+
+e.g. usage
+
+	e := trace.NewOTLP("http://localhost:4318/v1/traces", "users-api")
+	trace.Init(e, 0.1)
+	defer trace.Close()
+
+middleware.ApplyTrace starts a span for every request, continuing the trace of the
+caller if the request has a traceparent header. Code serving the request creates child
+spans from its context
+
+	ctx, span := trace.StartSpan(ctx, "render")
+	defer span.Finish()
+*/
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t is not all zeros
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether s is not all zeros
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span propagated to other processes
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// Kind is the role of a span in a trace
+type Kind int
+
+// Span kinds, with the values used by OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanData is a finished span, as handed to exporters
+type SpanData struct {
+	SpanContext
+	ParentID   SpanID
+	Name       string
+	Kind       Kind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        string
+}
+
+// Span is an operation within a trace. It is safe for concurrent use.
+type Span struct {
+	mu       sync.Mutex
+	data     SpanData
+	finished bool
+}
+
+// Context returns the span's context
+func (s *Span) Context() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetName renames the span, e.g. once the route of a request is known
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	s.data.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span and exports it if it is sampled. Calls after the first are ignored.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.data.End = time.Now()
+	d := s.data
+	d.Attributes = make(map[string]string, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		d.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	if !d.Sampled {
+		return
+	}
+	mu.RLock()
+	e := exporter
+	mu.RUnlock()
+	if e != nil {
+		e.Export(d)
+	}
+}
+
+// Exporter sends finished spans to a tracing backend. Export must not block.
+type Exporter interface {
+	Export(s SpanData)
+	Close() error
+}
+
+var (
+	mu         sync.RWMutex
+	exporter   Exporter
+	sampleRate = 1.0
+)
+
+// Init sets the exporter of the sampled spans, and the fraction of new traces to sample.
+// Traces continued from a caller keep the caller's sampling decision.
+func Init(e Exporter, rate float64) {
+	mu.Lock()
+	exporter = e
+	sampleRate = rate
+	mu.Unlock()
+}
+
+// Close closes the exporter, flushing the pending spans
+func Close() error {
+	mu.Lock()
+	e := exporter
+	exporter = nil
+	mu.Unlock()
+	if e == nil {
+		return nil
+	}
+	return e.Close()
+}
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+	remoteKey
+)
+
+// FromContext returns the span in ctx, or nil if there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// NewContext returns a copy of ctx carrying s
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey, s)
+}
+
+// WithRemoteParent returns a copy of ctx carrying the span context of a caller, to be
+// used as the parent of the next span started
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// StartSpan starts an internal span, child of the span in ctx, and returns a copy of ctx carrying it
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return StartSpanKind(ctx, name, KindInternal)
+}
+
+// StartSpanKind starts a span of the given kind, child of the span in ctx or of the remote
+// parent set by WithRemoteParent. A new trace is started if there's neither.
+func StartSpanKind(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{data: SpanData{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+	}}
+	var parent SpanContext
+	if p := FromContext(ctx); p != nil {
+		parent = p.Context()
+	} else if sc, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		parent = sc
+	}
+	if parent.TraceID.IsValid() {
+		s.data.TraceID = parent.TraceID
+		s.data.ParentID = parent.SpanID
+		s.data.Sampled = parent.Sampled
+		s.data.TraceState = parent.TraceState
+	} else {
+		s.data.TraceID = newTraceID()
+		s.data.Sampled = sample()
+	}
+	s.data.SpanID = newSpanID()
+	return NewContext(ctx, s), s
+}
+
+// Do runs fn in a span named name, child of the span in ctx, marking the span as failed if fn fails
+func Do(ctx context.Context, name string, attrs map[string]string, fn func(ctx context.Context) error) error {
+	ctx, s := StartSpanKind(ctx, name, KindClient)
+	for k, v := range attrs {
+		s.SetAttribute(k, v)
+	}
+	err := fn(ctx)
+	s.SetError(err)
+	s.Finish()
+	return err
+}
+
+func sample() bool {
+	mu.RLock()
+	rate := sampleRate
+	mu.RUnlock()
+	return rate >= 1 || (rate > 0 && mrand.Float64() < rate)
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	randomize(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	randomize(s[:])
+	return s
+}
+
+// randomize fills b with random bytes, falling back to math/rand if the system's source fails
+func randomize(b []byte) {
+	if _, err := rand.Read(b); err == nil {
+		return
+	}
+	for i := 0; i < len(b); i += 8 {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(mrand.Int63()))
+		copy(b[i:], buf[:])
+	}
+}
+
+// Traceparent returns sc formatted as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	// version-traceid-spanid-flags; later versions may append fields
+	if len(s) < 55 || strings.ToLower(s) != s || s[2] != '-' || s[35] != '-' || s[52] != '-' || (len(s) > 55 && s[55] != '-') {
+		return sc, fmt.Errorf("trace: malformed traceparent %q", s)
+	}
+	version, err := hex.DecodeString(s[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(s) != 55) {
+		return sc, fmt.Errorf("trace: unsupported traceparent version %q", s[:2])
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil || !sc.TraceID.IsValid() {
+		return sc, fmt.Errorf("trace: invalid trace id in %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil || !sc.SpanID.IsValid() {
+		return sc, fmt.Errorf("trace: invalid span id in %q", s)
+	}
+	flags, err := hex.DecodeString(s[53:55])
+	if err != nil {
+		return sc, fmt.Errorf("trace: invalid flags in %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
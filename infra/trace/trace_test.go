@@ -0,0 +1,105 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context"
+)
+
+func TestTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Error("Unexpected span context:", sc)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Error("Expected:", tp, "Got:", got)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Error("Expected an error for", invalid)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	m := NewInMemory()
+	Init(m, 1)
+	defer Init(nil, 1)
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, "vendor=x")
+	sc, ok := Extract(h)
+	if !ok {
+		t.Fatal("Expected a span context")
+	}
+	ctx, server := StartSpanKind(WithRemoteParent(context.Background(), sc), "GET /users/:id", KindServer)
+	errQuery := errors.New("query failed")
+	Do(ctx, "mysql select", nil, func(ctx context.Context) error { return errQuery })
+	out := http.Header{}
+	Inject(ctx, out)
+	server.Finish()
+
+	spans := m.Spans()
+	if len(spans) != 2 {
+		t.Fatal("Expected 2 spans, Got:", spans)
+	}
+	child, root := spans[0], spans[1]
+	if root.TraceID != sc.TraceID || root.ParentID != sc.SpanID || root.TraceState != "vendor=x" {
+		t.Error("Server span doesn't continue the remote trace:", root)
+	}
+	if child.TraceID != sc.TraceID || child.ParentID != root.SpanID || child.Err != errQuery.Error() {
+		t.Error("Unexpected child span:", child)
+	}
+	if got, expected := out.Get(TraceparentHeader), root.Traceparent(); got != expected {
+		t.Error("Injected: Expected:", expected, "Got:", got)
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	var req otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(d, &req)
+	}))
+	defer srv.Close()
+
+	o := NewOTLP(srv.URL, "test")
+	Init(o, 1)
+	_, s := StartSpan(context.Background(), "work")
+	s.SetAttribute("k", "v")
+	s.Finish()
+	Close()
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatal("Unexpected request:", req)
+	}
+	sp := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if sp.Name != "work" || sp.TraceID != s.Context().TraceID.String() || len(sp.Attributes) != 1 {
+		t.Error("Unexpected span:", sp)
+	}
+
+	// the spans exported after Close are counted as dropped
+	o.Export(SpanData{Name: "late"})
+	if c := gometrics.DefaultRegistry.Get(`trace_spans_dropped_total{reason="closed"}`); c == nil || c.(gometrics.Counter).Count() != 1 {
+		t.Error("Expected the span to be counted as dropped, Got:", c)
+	}
+}
@@ -10,16 +10,13 @@ import (
 	"golang.org/x/net/context"
 )
 
-//Apply404 is a middleware that supplies a custom 404 handler
+//Apply404 is a middleware that supplies a custom 404 handler.
+//CORS preflight requests are answered by the CORS middleware and never reach here
 //TODO: Change it to accept a custom 404 handler
 func Apply404(h goji.Handler) goji.Handler {
 	return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		handler := middleware.Handler(ctx)
 		if handler == nil {
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(200)
-				return
-			}
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.Header().Set("X-Content-Type-Options", "nosniff")
 			w.WriteHeader(404)
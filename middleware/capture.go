@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/middleware/mutil"
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+// DefaultCaptureMaxBytes is the number of bytes of each body captured by default
+const DefaultCaptureMaxBytes = 64 << 10
+
+// DefaultCaptureContentTypes are the content types captured by default
+var DefaultCaptureContentTypes = []string{"application/json", "application/problem+json", "application/x-www-form-urlencoded", "text/"}
+
+// CaptureOptions configures the Capture middleware
+type CaptureOptions struct {
+	// Routes are the routes whose requests are captured, as reported by Route. The route is
+	// checked once the handler starts reading the request or writing the response.
+	Routes []string
+	// Header enables the capture of a request when present on it, e.g. "X-Debug-Capture"
+	Header string
+	// Token, if set, is the value Header must have to enable the capture
+	Token string
+
+	// MaxBytes is the number of bytes of each body captured. DefaultCaptureMaxBytes is used if 0.
+	MaxBytes int
+	// ContentTypes are the content types, or prefixes of them like "text/", whose bodies are
+	// captured. DefaultCaptureContentTypes is used if empty.
+	ContentTypes []string
+	// RedactHeaders are the headers whose values are redacted, e.g. "Authorization"
+	RedactHeaders []string
+	// RedactPatterns are redacted wherever they match in the bodies and headers, e.g. passwords in JSON
+	RedactPatterns []*regexp.Regexp
+
+	// Logger, if set, gets a log event for every capture
+	Logger log.Logger
+	// Buffer, if set, keeps the latest captures
+	Buffer *CaptureBuffer
+}
+
+// Capture is a request and response captured by the Capture middleware
+type Capture struct {
+	Time              time.Time         `json:"time"`
+	ReqID             string            `json:"req_id"`
+	Method            string            `json:"method"`
+	URI               string            `json:"uri"` // the path, without the query which may hold secrets
+	Route             string            `json:"route"`
+	Status            int               `json:"status"`
+	RequestHeaders    map[string]string `json:"request_headers"`
+	RequestBody       string            `json:"request_body,omitempty"`
+	RequestTruncated  bool              `json:"request_truncated,omitempty"`
+	ResponseHeaders   map[string]string `json:"response_headers"`
+	ResponseBody      string            `json:"response_body,omitempty"`
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+}
+
+/*
+CaptureBodies is a goji middleware that records the request and response bodies of the
+requests to the configured routes, or carrying the configured header, for debugging.
+The request body is recorded as the handler reads it; the response body is teed from the
+writer. Captures go to the logger and/or the ring buffer of the options.
+
+	buf := middleware.NewCaptureBuffer(100)
+	m.UseC(middleware.CaptureBodies(middleware.CaptureOptions{
+		Header:        "X-Debug-Capture",
+		Token:         conf.Debug.Token,
+		RedactHeaders: []string{"Authorization", "Cookie"},
+		Buffer:        buf,
+	}))
+	admin.Handle(pat.New("/captures"), buf)
+
+Bodies may hold personal data; only enable it while debugging, and mount the buffer on an internal route.
+*/
+func CaptureBodies(o CaptureOptions) func(goji.Handler) goji.Handler {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultCaptureMaxBytes
+	}
+	if len(o.ContentTypes) == 0 {
+		o.ContentTypes = DefaultCaptureContentTypes
+	}
+	routes := map[string]bool{}
+	for _, r := range o.Routes {
+		routes[r] = true
+	}
+	redactHeaders := map[string]bool{}
+	for _, h := range o.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return func(h goji.Handler) goji.Handler {
+		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			flagged := false
+			if v := r.Header.Get(o.Header); o.Header != "" && v != "" {
+				flagged = o.Token == "" || subtle.ConstantTimeCompare([]byte(v), []byte(o.Token)) == 1
+			}
+			if !flagged && len(routes) == 0 {
+				h.ServeHTTPC(ctx, w, r)
+				return
+			}
+
+			start := time.Now()
+			ctx, patterns := withPatterns(ctx)
+			// the route is known once the request reached its handler, so the bodies are only
+			// buffered from there on if it is to be captured
+			var once sync.Once
+			var capturing bool
+			capture := func() bool {
+				once.Do(func() {
+					capturing = flagged || routes[joinPatterns(*patterns)]
+				})
+				return capturing
+			}
+			reqBody := &limitedBuffer{max: o.MaxBytes, enabled: capture}
+			if r.Body != nil {
+				r.Body = teeReadCloser{io.TeeReader(r.Body, reqBody), r.Body}
+			}
+			respBody := &limitedBuffer{max: o.MaxBytes, enabled: capture}
+			ww := mutil.WrapWriter(w)
+			ww.Tee(respBody)
+
+			h.ServeHTTPC(ctx, ww, r)
+
+			if !capture() {
+				return
+			}
+			c := Capture{
+				Time:            start.UTC(),
+				ReqID:           GetReqID(ctx),
+				Method:          r.Method,
+				URI:             r.URL.Path,
+				Route:           joinPatterns(*patterns),
+				Status:          ww.Status(),
+				RequestHeaders:  captureHeaders(r.Header, redactHeaders, o.RedactPatterns),
+				ResponseHeaders: captureHeaders(ww.Header(), redactHeaders, o.RedactPatterns),
+			}
+			if c.Status == 0 {
+				c.Status = http.StatusOK
+			}
+			c.RequestBody, c.RequestTruncated = captureBody(r.Header, reqBody, o)
+			c.ResponseBody, c.ResponseTruncated = captureBody(ww.Header(), respBody, o)
+
+			if o.Logger != nil {
+				o.Logger.Info(
+					"type", "capture",
+					"req_id", c.ReqID,
+					"method", c.Method,
+					"uri", c.URI,
+					"route", c.Route,
+					"status", c.Status,
+					"request_headers", c.RequestHeaders,
+					"request_body", c.RequestBody,
+					"response_headers", c.ResponseHeaders,
+					"response_body", c.ResponseBody)
+			}
+			if o.Buffer != nil {
+				o.Buffer.Add(c)
+			}
+		})
+	}
+}
+
+func captureHeaders(h http.Header, redactHeaders map[string]bool, patterns []*regexp.Regexp) map[string]string {
+	m := make(map[string]string, len(h))
+	for k, v := range h {
+		if redactHeaders[k] {
+			m[k] = redacted
+			continue
+		}
+		m[k] = redactAll(strings.Join(v, ", "), patterns)
+	}
+	return m
+}
+
+func captureBody(h http.Header, b *limitedBuffer, o CaptureOptions) (string, bool) {
+	if b.buf.Len() == 0 {
+		return "", false
+	}
+	if !captured(h.Get("Content-Type"), o.ContentTypes) {
+		return "", false
+	}
+	return redactAll(b.buf.String(), o.RedactPatterns), b.truncated
+}
+
+// captured reports whether bodies of content type ct are to be captured
+func captured(ct string, types []string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if mt == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mt, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAll(s string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest. It discards
+// everything if enabled returns false.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+	enabled   func() bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if !b.enabled() {
+		return len(p), nil
+	}
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// CaptureBuffer is a ring buffer of the latest captures. It is an http.Handler responding
+// with the captures as JSON, oldest first; they can be filtered by the req_id parameter.
+// DELETE clears the buffer.
+type CaptureBuffer struct {
+	mu      sync.Mutex
+	entries []Capture
+	next    int
+	full    bool
+}
+
+// NewCaptureBuffer returns a CaptureBuffer keeping the latest size captures
+func NewCaptureBuffer(size int) *CaptureBuffer {
+	return &CaptureBuffer{entries: make([]Capture, size)}
+}
+
+// Add adds c to the buffer, evicting the oldest capture if it is full
+func (b *CaptureBuffer) Add(c Capture) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return
+	}
+	b.entries[b.next] = c
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Captures returns the captures in the buffer, oldest first
+func (b *CaptureBuffer) Captures() []Capture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]Capture(nil), b.entries[:b.next]...)
+	}
+	return append(append([]Capture(nil), b.entries[b.next:]...), b.entries[:b.next]...)
+}
+
+// Reset removes all the captures
+func (b *CaptureBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make([]Capture, len(b.entries))
+	b.next, b.full = 0, false
+}
+
+func (b *CaptureBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "DELETE":
+		b.Reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	captures := b.Captures()
+	if id := r.FormValue("req_id"); id != "" {
+		var matched []Capture
+		for _, c := range captures {
+			if c.ReqID == id {
+				matched = append(matched, c)
+			}
+		}
+		captures = matched
+	}
+	if captures == nil {
+		captures = []Capture{}
+	}
+	d, err := json.Marshal(captures)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(d)
+}
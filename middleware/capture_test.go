@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+func TestCaptureBodies(t *testing.T) {
+	buf := NewCaptureBuffer(2)
+	h := CaptureBodies(CaptureOptions{
+		Header:         "X-Debug-Capture",
+		MaxBytes:       16,
+		RedactHeaders:  []string{"Authorization"},
+		RedactPatterns: []*regexp.Regexp{regexp.MustCompile(`"password":"[^"]*"`)},
+		Buffer:         buf,
+	})(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1,"name":"a long name"}`))
+	}))
+
+	for _, flag := range []string{"", "1", "1", "1"} {
+		req, _ := http.NewRequest("POST", "/login?token=s3cr3t", strings.NewReader(`{"password":"x"}`))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		req.Header.Set("X-Debug-Capture", flag)
+		h.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+	}
+
+	captures := buf.Captures()
+	if len(captures) != 2 {
+		t.Fatal("Expected 2 captures, Got:", captures)
+	}
+	c := captures[1]
+	if c.URI != "/login" {
+		t.Error("URI: Expected:", "/login", "Got:", c.URI)
+	}
+	if c.RequestBody != "{REDACTED}" {
+		t.Error("Request body: Expected:", "{REDACTED}", "Got:", c.RequestBody)
+	}
+	if c.ResponseBody != `{"id":1,"name":"` || !c.ResponseTruncated {
+		t.Error("Response body: Expected truncated body, Got:", c.ResponseBody, c.ResponseTruncated)
+	}
+	if c.RequestHeaders["Authorization"] != "REDACTED" {
+		t.Error("Authorization: Expected:", "REDACTED", "Got:", c.RequestHeaders["Authorization"])
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/captures", nil)
+	buf.ServeHTTP(w, req)
+	var served []Capture
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil || len(served) != 2 {
+		t.Error("Expected 2 captures, Got:", w.Body.String(), err)
+	}
+}
+
+func TestCaptureToken(t *testing.T) {
+	buf := NewCaptureBuffer(10)
+	h := CaptureBodies(CaptureOptions{
+		Routes: []string{"/users"},
+		Header: "X-Debug-Capture",
+		Token:  "t0k3n",
+		Buffer: buf,
+	})(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	// the route doesn't match, only the token enables the capture
+	for _, token := range []string{"", "t0k3", "t0k3n!", "t0k3n"} {
+		req, _ := http.NewRequest("GET", "/login", nil)
+		req.Header.Set("X-Debug-Capture", token)
+		h.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+	}
+	if captures := buf.Captures(); len(captures) != 1 {
+		t.Error("Expected the request with the token to be captured only, Got:", captures)
+	}
+}
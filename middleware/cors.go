@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+// defaultCORSMethods are the methods allowed when CORSOptions.AllowedMethods is empty
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// defaultCORSHeaders are the request headers allowed when CORSOptions.AllowedHeaders is empty
+var defaultCORSHeaders = []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization"}
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins is the list of origins a cross-domain request can be executed from.
+	// An origin may contain a single "*" wildcard (e.g. "https://*.example.com").
+	// The special value "*" allows all origins. Default value is ["*"].
+	AllowedOrigins []string
+
+	// AllowOriginFunc is a custom function to validate the origin. If set, it is
+	// consulted when the origin does not match AllowedOrigins.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods is the list of methods the client is allowed to use.
+	// Default value is GET, POST, PUT, PATCH, DELETE and HEAD.
+	AllowedMethods []string
+
+	// MethodsFunc returns the methods registered for the resource requested. If set, the
+	// methods allowed are those it returns that are in AllowedMethods too, and preflight
+	// requests for resources it returns no methods for are rejected.
+	// mux.Init sets it to mux.AllowedMethods if left nil.
+	MethodsFunc func(ctx context.Context, r *http.Request) []string
+
+	// AllowedHeaders is the list of non-simple headers the client is allowed to use.
+	// The special value "*" allows any header requested.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the headers which are safe to expose to the client.
+	ExposedHeaders []string
+
+	// AllowCredentials indicates whether the request can include user credentials
+	// like cookies, HTTP authentication or client side SSL certificates.
+	AllowCredentials bool
+
+	// MaxAge indicates how long the results of a preflight request can be cached.
+	MaxAge time.Duration
+}
+
+type cors struct {
+	allowAll       bool
+	origins        []string
+	wildcards      [][2]string
+	originFunc     func(string) bool
+	methods        []string
+	methodsFunc    func(context.Context, *http.Request) []string
+	headers        []string
+	allowAllHeader bool
+	exposed        string
+	credentials    bool
+	maxAge         string
+}
+
+/*
+CORS returns a middleware that handles Cross-Origin Resource Sharing as per
+https://www.w3.org/TR/cors/
+
+Preflight requests (OPTIONS requests carrying an Access-Control-Request-Method
+header) are answered by the middleware itself and never reach the handlers.
+Preflight requests from disallowed origins, or for disallowed methods or headers,
+are rejected with 403. Actual requests from disallowed origins are passed on
+to the handler without any CORS headers, leaving it to the browser to block them.
+*/
+func CORS(o CORSOptions) func(goji.Handler) goji.Handler {
+	c := &cors{
+		originFunc:  o.AllowOriginFunc,
+		methodsFunc: o.MethodsFunc,
+		credentials: o.AllowCredentials,
+	}
+
+	origins := o.AllowedOrigins
+	if len(origins) == 0 && o.AllowOriginFunc == nil {
+		origins = []string{"*"}
+	}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			c.allowAll = true
+			break
+		}
+		if i := strings.IndexByte(origin, '*'); i >= 0 {
+			c.wildcards = append(c.wildcards, [2]string{origin[:i], origin[i+1:]})
+			continue
+		}
+		c.origins = append(c.origins, origin)
+	}
+
+	methods := o.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	for _, m := range methods {
+		c.methods = append(c.methods, strings.ToUpper(m))
+	}
+
+	headers := o.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.allowAllHeader = true
+			break
+		}
+		c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+	}
+
+	if len(o.ExposedHeaders) > 0 {
+		exposed := make([]string, len(o.ExposedHeaders))
+		for i, h := range o.ExposedHeaders {
+			exposed[i] = http.CanonicalHeaderKey(h)
+		}
+		c.exposed = strings.Join(exposed, ", ")
+	}
+
+	if o.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(o.MaxAge / time.Second))
+	}
+
+	return func(h goji.Handler) goji.Handler {
+		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(ctx, w, r)
+				return
+			}
+			c.actual(w, r)
+			h.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
+
+// preflight answers the preflight request
+func (c *cors) preflight(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	headers.Add("Vary", "Origin")
+	headers.Add("Vary", "Access-Control-Request-Method")
+	headers.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.isOriginAllowed(origin) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	methods := c.allowedMethods(ctx, r)
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !contains(methods, method) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	reqHeaders := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if !c.areHeadersAllowed(reqHeaders) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	c.setOrigin(w, origin)
+	headers.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(reqHeaders) > 0 {
+		headers.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.credentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.maxAge != "" {
+		headers.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// actual sets the CORS headers for a non-preflight request
+func (c *cors) actual(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.isOriginAllowed(origin) {
+		return
+	}
+	c.setOrigin(w, origin)
+	if c.exposed != "" {
+		w.Header().Set("Access-Control-Expose-Headers", c.exposed)
+	}
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// setOrigin sets Access-Control-Allow-Origin. Credentialed requests can't use
+// the "*" wildcard, so the origin is echoed back in that case.
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	if c.allowAll && !c.credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+func (c *cors) isOriginAllowed(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	o := strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if o == allowed {
+			return true
+		}
+	}
+	for _, w := range c.wildcards {
+		if len(o) >= len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	if c.originFunc != nil {
+		return c.originFunc(origin)
+	}
+	return false
+}
+
+// allowedMethods returns the configured methods registered for the requested resource, none
+// if the resource is unknown
+func (c *cors) allowedMethods(ctx context.Context, r *http.Request) []string {
+	if c.methodsFunc == nil {
+		return c.methods
+	}
+	var methods []string
+	for _, m := range c.methodsFunc(ctx, r) {
+		if contains(c.methods, m) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+func (c *cors) areHeadersAllowed(requested []string) bool {
+	if c.allowAllHeader {
+		return true
+	}
+	for _, h := range requested {
+		if !contains(c.headers, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeaderList parses the comma separated Access-Control-Request-Headers value
+func parseHeaderList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	var headers []string
+	for _, h := range strings.Split(v, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" {
+			headers = append(headers, http.CanonicalHeaderKey(h))
+		}
+	}
+	return headers
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
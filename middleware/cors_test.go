@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+func serveCORS(o CORSOptions, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	h := CORS(o)(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTPC(context.Background(), w, r)
+	return w, reached
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	r, _ := http.NewRequest("OPTIONS", "/users/42", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestCORSPreflight(t *testing.T) {
+	routes := func(ctx context.Context, r *http.Request) []string {
+		if r.URL.Path == "/users/42" {
+			return []string{"DELETE", "GET", "HEAD", "OPTIONS"}
+		}
+		return nil
+	}
+	o := CORSOptions{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{"GET", "HEAD", "PUT"},
+		MethodsFunc:    routes,
+		MaxAge:         10 * time.Minute,
+	}
+
+	w, reached := serveCORS(o, preflight("https://app.example.com", "GET", "content-type"))
+	if reached || w.Code != http.StatusNoContent {
+		t.Fatal("Expected the preflight to be answered with 204, Got:", w.Code, reached)
+	}
+	for h, expected := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := w.Header().Get(h); got != expected {
+			t.Error(h, "Expected:", expected, "Got:", got)
+		}
+	}
+	if vary := w.Header()["Vary"]; len(vary) != 3 {
+		t.Error("Expected Vary on the origin and the requested method and headers, Got:", vary)
+	}
+
+	for name, r := range map[string]*http.Request{
+		"origin":           preflight("https://example.org", "GET", ""),
+		"wildcard":         preflight("https://example.com", "GET", ""),
+		"method not added": preflight("https://app.example.com", "PUT", ""),
+		"method not set":   preflight("https://app.example.com", "DELETE", ""),
+		"header":           preflight("https://app.example.com", "GET", "X-Secret"),
+	} {
+		if w, _ := serveCORS(o, r); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Error(name, "Expected the preflight to be rejected, Got:", w.Code, w.Header())
+		}
+	}
+
+	// unknown routes are rejected
+	r := preflight("https://app.example.com", "GET", "")
+	r.URL.Path = "/unknown"
+	if w, _ := serveCORS(o, r); w.Code != http.StatusForbidden {
+		t.Error("Expected the preflight of an unknown route to be rejected, Got:", w.Code)
+	}
+}
+
+func TestCORSActual(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/users/42", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+
+	// all origins are allowed by default
+	w, reached := serveCORS(CORSOptions{ExposedHeaders: []string{"x-request-id"}}, r)
+	if !reached || w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Error("Unexpected headers:", w.Header(), reached)
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Error("Expected Vary: Origin, Got:", w.Header()["Vary"])
+	}
+
+	// credentialed requests get their origin echoed rather than the wildcard
+	w, _ = serveCORS(CORSOptions{AllowCredentials: true}, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Unexpected headers:", w.Header())
+	}
+
+	// disallowed origins reach the handler without CORS headers
+	w, reached = serveCORS(CORSOptions{AllowedOrigins: []string{"https://example.org"}}, r)
+	if !reached || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "Origin" {
+		t.Error("Unexpected headers:", w.Header(), reached)
+	}
+}
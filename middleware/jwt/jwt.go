@@ -17,6 +17,7 @@ import (
 
 	"os"
 
+	bingolog "github.com/hifx/bingo/infra/log"
 	"goji.io"
 	"golang.org/x/net/context"
 	"gopkg.in/square/go-jose.v1"
@@ -55,6 +56,9 @@ const (
 
 	// TOKENERROR denotes the key to get the token error from context
 	TOKENERROR = "TokenError"
+
+	// TOKEN denotes the key to get the raw token of a valid request from context
+	TOKEN = "Token"
 )
 
 // ErrInvalidToken indicates an invalid token
@@ -231,7 +235,7 @@ func generateHandler(h, errorHandler goji.Handler) goji.Handler {
 				errorHandler.ServeHTTPC(context.WithValue(ctx, TOKENERROR, ErrTokenExpired), w, r)
 				return
 			}
-			h.ServeHTTPC(context.WithValue(ctx, CLAIMS, c), w, r)
+			h.ServeHTTPC(withClaims(ctx, c, token), w, r)
 		case jwe:
 			claims, err := decryptJWEToken(token)
 			if err != nil {
@@ -248,7 +252,7 @@ func generateHandler(h, errorHandler goji.Handler) goji.Handler {
 				errorHandler.ServeHTTPC(context.WithValue(ctx, TOKENERROR, ErrTokenExpired), w, r)
 				return
 			}
-			h.ServeHTTPC(context.WithValue(ctx, CLAIMS, c), w, r)
+			h.ServeHTTPC(withClaims(ctx, c, token), w, r)
 		case invalid:
 			errorHandler.ServeHTTPC(context.WithValue(ctx, TOKENERROR, ErrInvalidToken{ErrUnrecognizedTokenFormat}), w, r)
 		case absent:
@@ -257,6 +261,21 @@ func generateHandler(h, errorHandler goji.Handler) goji.Handler {
 	})
 }
 
+// withClaims stores the claims and the token in ctx and adds the user's subject to the request's logger, if any
+func withClaims(ctx context.Context, c Claims, token string) context.Context {
+	ctx = context.WithValue(context.WithValue(ctx, CLAIMS, c), TOKEN, token)
+	if l := bingolog.FromContext(ctx); l != bingolog.Discard && c.Sub != "" {
+		ctx = bingolog.NewContext(ctx, l.With("user", c.Sub))
+	}
+	return ctx
+}
+
+// GetToken returns the raw token of the request, if it was validated
+func GetToken(ctx context.Context) string {
+	t, _ := ctx.Value(TOKEN).(string)
+	return t
+}
+
 // decryptJWEToken parses a JWE token and returns the decrypted payload
 func decryptJWEToken(token string) ([]byte, error) {
 	e, err := jose.ParseEncrypted(token)
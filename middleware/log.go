@@ -2,34 +2,180 @@ package middleware
 
 import (
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/hifx/bingo/infra/log"
-	"github.com/zenazn/goji/web/mutil"
+	"github.com/hifx/bingo/middleware/mutil"
 	"goji.io"
 	"golang.org/x/net/context"
 )
 
-// ApplyLog is a goji middleware that logs all requests to the logger provided
-func ApplyLog(l log.Logger) func(goji.Handler) goji.Handler {
+// redacted replaces the redacted values in the access log
+const redacted = "REDACTED"
+
+// LogOptions configures the Log middleware
+type LogOptions struct {
+	// RedactQuery are the query parameters whose values are redacted from the logged uri, e.g. "token"
+	RedactQuery []string
+	// RedactHeaders are the headers whose values are redacted when logged, e.g. "Authorization"
+	RedactHeaders []string
+	// RedactPatterns are redacted wherever they match in the logged uri and headers, e.g. email addresses
+	RedactPatterns []*regexp.Regexp
+
+	// RequestHeaders are the request headers to log, as req_<header> fields, e.g. req_user_agent
+	RequestHeaders []string
+	// ResponseHeaders are the response headers to log, as resp_<header> fields
+	ResponseHeaders []string
+	// Bytes logs the size of the request body read by the handler as bytes_in and of the
+	// response body as bytes_out
+	Bytes bool
+
+	// SampleEvery logs one out of every n requests to the routes, e.g. {"/ping": 100}. Routes are
+	// the patterns as reported by Route. Requests with a status of 400 or above are always logged.
+	SampleEvery map[string]int
+	// DefaultSampleEvery is the sampling of the routes not in SampleEvery. All requests are logged if it is 0.
+	DefaultSampleEvery int
+}
+
+/*
+Log is a goji middleware that logs all requests to the logger provided, redacting
+and sampling them as per o
+
+	middleware.Log(acslog, middleware.LogOptions{
+		RedactQuery:    []string{"token", "email"},
+		RedactHeaders:  []string{"Authorization"},
+		RequestHeaders: []string{"User-Agent", "Authorization"},
+		Bytes:          true,
+		SampleEvery:    map[string]int{"/healthz": 100},
+	})
+*/
+func Log(l log.Logger, o LogOptions) func(goji.Handler) goji.Handler {
+	redactQuery := map[string]bool{}
+	for _, q := range o.RedactQuery {
+		redactQuery[q] = true
+	}
+	redactHeaders := map[string]bool{}
+	for _, h := range o.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	redact := func(s string) string {
+		return redactAll(s, o.RedactPatterns)
+	}
+	header := func(h http.Header, name string) string {
+		if redactHeaders[http.CanonicalHeaderKey(name)] && h.Get(name) != "" {
+			return redacted
+		}
+		return redact(strings.Join(h[http.CanonicalHeaderKey(name)], ", "))
+	}
+
 	return func(h goji.Handler) goji.Handler {
 		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			reqid := GetReqID(ctx)
+			ctx, patterns := withPatterns(ctx)
 
+			// the length of the request body is unknown when chunked, count what is read instead
+			var body *countingBody
+			if o.Bytes && r.Body != nil {
+				body = &countingBody{ReadCloser: r.Body}
+				r.Body = body
+			}
 			ww := mutil.WrapWriter(w)
 			h.ServeHTTPC(ctx, ww, r)
 
-			latency := float64(time.Since(start)) / float64(time.Millisecond)
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := joinPatterns(*patterns)
+			if status < http.StatusBadRequest && !sampled(route, o) {
+				return
+			}
 
-			l.Info(
+			latency := float64(time.Since(start)) / float64(time.Millisecond)
+			keyvals := []interface{}{
 				"req_id", reqid,
-				"uri", r.RequestURI,
+				"uri", redact(redactURI(r, redactQuery)),
 				"method", r.Method,
 				"remote", r.RemoteAddr,
-				"status", ww.Status(),
-				"latency", fmt.Sprintf("%6.4f ms", latency))
+				"route", route,
+				"status", status,
+				"latency", fmt.Sprintf("%6.4f ms", latency),
+			}
+			for _, name := range o.RequestHeaders {
+				keyvals = append(keyvals, "req_"+headerField(name), header(r.Header, name))
+			}
+			for _, name := range o.ResponseHeaders {
+				keyvals = append(keyvals, "resp_"+headerField(name), header(ww.Header(), name))
+			}
+			if o.Bytes {
+				var in int64
+				if body != nil {
+					in = body.n
+				}
+				keyvals = append(keyvals, "bytes_in", in, "bytes_out", ww.BytesWritten())
+			}
+			l.Info(keyvals...)
 		})
 	}
 }
+
+// ApplyLog is a goji middleware that logs all requests to the logger provided
+func ApplyLog(l log.Logger) func(goji.Handler) goji.Handler {
+	return Log(l, LogOptions{})
+}
+
+// sampled reports whether a successful request to route is to be logged
+func sampled(route string, o LogOptions) bool {
+	n, ok := o.SampleEvery[route]
+	if !ok {
+		n = o.DefaultSampleEvery
+	}
+	return n <= 1 || rand.Intn(n) == 0
+}
+
+// redactURI returns the request uri with the values of the query parameters in redact replaced
+func redactURI(r *http.Request, redact map[string]bool) string {
+	if len(redact) == 0 || r.URL.RawQuery == "" {
+		return r.RequestURI
+	}
+	params := strings.Split(r.URL.RawQuery, "&")
+	changed := false
+	for i, p := range params {
+		k := p
+		if j := strings.IndexByte(p, '='); j >= 0 {
+			k = p[:j]
+		}
+		if uk, err := url.QueryUnescape(k); err == nil && redact[uk] {
+			params[i] = k + "=" + redacted
+			changed = true
+		}
+	}
+	if !changed {
+		return r.RequestURI
+	}
+	return r.URL.EscapedPath() + "?" + strings.Join(params, "&")
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// headerField returns the log field name for a header, e.g. user_agent for User-Agent
+func headerField(name string) string {
+	return strings.ToLower(strings.Replace(name, "-", "_", -1))
+}
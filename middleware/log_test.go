@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hifx/bingo/infra/log"
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+type captureLogger struct {
+	log.Logger
+	events *[][]interface{}
+}
+
+func (c captureLogger) Info(keyvals ...interface{}) { *c.events = append(*c.events, keyvals) }
+
+func field(keyvals []interface{}, key string) string {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == key {
+			return fmt.Sprint(keyvals[i+1])
+		}
+	}
+	return ""
+}
+
+func TestLog(t *testing.T) {
+	var events [][]interface{}
+	status := http.StatusOK
+	h := Log(captureLogger{log.Discard, &events}, LogOptions{
+		RedactQuery:        []string{"token"},
+		RedactHeaders:      []string{"Authorization"},
+		RedactPatterns:     []*regexp.Regexp{regexp.MustCompile(`[^/?&=]+@[^/?&=]+`)},
+		RequestHeaders:     []string{"Authorization", "User-Agent"},
+		Bytes:              true,
+		DefaultSampleEvery: 1000000,
+	})(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("hello"))
+	}))
+
+	serve := func() {
+		req, _ := http.NewRequest("POST", "/users/a@b.com?token=s3cr3t&page=2", strings.NewReader("body"))
+		// e.g. a chunked body
+		req.ContentLength = -1
+		req.RequestURI = "/users/a@b.com?token=s3cr3t&page=2"
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		req.Header.Set("User-Agent", "test")
+		h.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+	}
+
+	// successful requests are sampled out, errors are always logged
+	serve()
+	status = http.StatusInternalServerError
+	serve()
+
+	if len(events) != 1 {
+		t.Fatal("Expected 1 event, Got:", events)
+	}
+	for key, expected := range map[string]string{
+		"uri":               "/users/REDACTED?token=REDACTED&page=2",
+		"status":            "500",
+		"req_authorization": "REDACTED",
+		"req_user_agent":    "test",
+		"bytes_in":          "4",
+		"bytes_out":         "5",
+	} {
+		if got := field(events[0], key); got != expected {
+			t.Error(key, "Expected:", expected, "Got:", got)
+		}
+	}
+}
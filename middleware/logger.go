@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hifx/bingo/infra/log"
+	"goji.io"
+	"goji.io/middleware"
+	"golang.org/x/net/context"
+)
+
+// ApplyLogger is a goji middleware that stores l, with the request's fields, in the context.
+// Handlers get it back with log.FromContext, so that their log lines carry req_id, method,
+// uri and remote without repeating them. The uri is the path of the request, without the query
+// which may hold secrets. It should be used after ApplyReqID.
+func ApplyLogger(l log.Logger) func(goji.Handler) goji.Handler {
+	return func(h goji.Handler) goji.Handler {
+		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			ctx = log.NewContext(ctx, requestLogger(ctx, l, r))
+			h.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
+
+// requestLogger returns l with the fields identifying the request
+func requestLogger(ctx context.Context, l log.Logger, r *http.Request) log.Logger {
+	return l.With(
+		"req_id", GetReqID(ctx),
+		"method", r.Method,
+		"uri", r.URL.Path,
+		"remote", r.RemoteAddr)
+}
+
+// Logger returns the logger stored in ctx by ApplyLogger. If there is none, it returns
+// fallback with the request's fields.
+func Logger(ctx context.Context, fallback log.Logger, r *http.Request) log.Logger {
+	if l := log.FromContext(ctx); l != log.Discard {
+		return l
+	}
+	return requestLogger(ctx, fallback, r)
+}
+
+// Route returns the pattern of the route matched by the request, e.g. "/users/:id", joining
+// the patterns of nested muxes if Stats and ApplySubStats are in use. It returns an empty string
+// if the request hasn't matched any pattern yet.
+func Route(ctx context.Context) string {
+	var patterns []goji.Pattern
+	if p, ok := ctx.Value(PATKEY).(*[]goji.Pattern); ok {
+		patterns = *p
+	} else if curr := middleware.Pattern(ctx); curr != nil {
+		patterns = []goji.Pattern{curr}
+	}
+	return joinPatterns(patterns)
+}
+
+// withPatterns returns ctx carrying the list of the patterns matched by the request, which
+// ApplySubStats fills as the request goes through nested muxes. A list already in ctx is
+// reused, so that all the middlewares of the outer mux share it.
+func withPatterns(ctx context.Context) (context.Context, *[]goji.Pattern) {
+	if p, ok := ctx.Value(PATKEY).(*[]goji.Pattern); ok {
+		return ctx, p
+	}
+	var patterns []goji.Pattern
+	if curr := middleware.Pattern(ctx); curr != nil {
+		patterns = append(patterns, curr)
+	}
+	return context.WithValue(ctx, PATKEY, &patterns), &patterns
+}
+
+func joinPatterns(patterns []goji.Pattern) string {
+	patstrs := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		patstr, ok := pattern.(fmt.Stringer)
+		if !ok {
+			continue
+		}
+		patstrs[i] = strings.TrimSuffix(patstr.String(), "/*")
+	}
+	route := path.Join(patstrs...)
+	if route == "." {
+		return ""
+	}
+	return route
+}
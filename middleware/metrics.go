@@ -3,7 +3,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,48 +17,102 @@ import (
 //PATKEY is the key used to store matched patterns in context
 const PATKEY = "metrics.pattern"
 
+// unmatchedRoute is the route label used for requests that didn't match any pattern
+const unmatchedRoute = "unmatched"
+
+// otherMethod is the method label used for the methods outside the standard ones
+const otherMethod = "OTHER"
+
+// methodLabel returns the method label of r, so that clients sending arbitrary methods
+// don't create new series
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return r.Method
+	}
+	return otherMethod
+}
+
+// StatsOptions configures the Stats middleware
+type StatsOptions struct {
+	// Buckets are the upper bounds, in seconds, of the latency histogram buckets.
+	// metrics.DefBuckets is used if empty.
+	Buckets []float64
+
+	// StatusClass reports the status code as its class, e.g. "2xx" instead of "204",
+	// to keep the number of series low.
+	StatusClass bool
+
+	// Legacy records the metrics under the dot-joined names used by earlier versions,
+	// e.g. "foo.:bar.request", instead of the labeled metrics.
+	Legacy bool
+}
+
+var applyStats = Stats(StatsOptions{})
+
 /*
-ApplyStats wraps a handler to track request counts and response status
-code counts name-spaced by goji Pattern. It will only include
-patterns that implement fmt.Stringer. For example, if a request
-matches the pattern /foo/:bar and returns a 204 status code, it
-will increment "foo.:bar.request" and "foo.:bar.response.204".
-In addition it updates a histogram with response latencies
+Stats returns a middleware that tracks request counts and latencies labeled by
+the goji pattern matched, the HTTP method and the response status code. It will
+only include patterns that implement fmt.Stringer. For example, if a GET request
+matches the pattern /foo/:bar and returns a 204 status code, it will increment
+
+	http_requests_total{route="/foo/:bar",method="GET",code="204"}
+
+and observe the latency in the http_request_duration_seconds histogram with the
+same labels. Requests not matching any pattern are labeled route="unmatched", and
+methods other than the standard ones method="OTHER".
+
+With Legacy set, it will instead increment "foo.:bar.request" and "foo.:bar.response.204",
+and update the "foo.:bar.latency" timer. Unmatched requests are not tracked in this mode.
 
 largely influenced by https://github.com/metcalf/saypi
 */
-func ApplyStats(h goji.Handler) goji.Handler {
-	return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		var patterns []goji.Pattern
-		start := time.Now()
+func Stats(o StatsOptions) func(goji.Handler) goji.Handler {
+	requests := metrics.NewCounter("http_requests_total")
+	latency := metrics.NewTimer("http_request_duration_seconds", o.Buckets)
 
-		curr := middleware.Pattern(ctx)
-		if curr != nil {
-			patterns = append(patterns, curr)
-		}
+	return func(h goji.Handler) goji.Handler {
+		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, patterns := withPatterns(ctx)
 
-		ctx = context.WithValue(ctx, PATKEY, &patterns)
+			ww := mutil.WrapWriter(w)
+			h.ServeHTTPC(ctx, ww, r)
 
-		ww := mutil.WrapWriter(w)
-		h.ServeHTTPC(ctx, ww, r)
+			route := joinPatterns(*patterns)
 
-		patstrs := make([]string, len(patterns))
-		for i, pattern := range patterns {
-			patstr, ok := pattern.(fmt.Stringer)
-			if !ok {
-				continue
+			if o.Legacy {
+				patclean := strings.Trim(strings.Replace(route, "/", ".", -1), ".")
+				if patclean != "" {
+					metrics.AddCounter(fmt.Sprintf("%s.request", patclean))
+					metrics.AddCounter(fmt.Sprintf("%s.response.%d", patclean, ww.Status()))
+					metrics.UpdateTimerSince(fmt.Sprintf("%s.latency", patclean), start)
+				}
+				return
 			}
 
-			patstrs[i] = strings.TrimSuffix(patstr.String(), "/*")
-		}
-		patclean := strings.Trim(strings.Replace(path.Join(patstrs...), "/", ".", -1), ".")
+			if route == "" {
+				route = unmatchedRoute
+			}
+			status := ww.Status()
+			if status == 0 {
+				// nothing was written, net/http will reply with a 200
+				status = http.StatusOK
+			}
+			code := strconv.Itoa(status)
+			if o.StatusClass {
+				code = code[:1] + "xx"
+			}
+			labels := metrics.Labels{"route": route, "method": methodLabel(r), "code": code}
+			requests.Inc(labels)
+			latency.ObserveSince(labels, start)
+		})
+	}
+}
 
-		if patclean != "" {
-			metrics.AddCounter(fmt.Sprintf("%s.request", patclean))
-			metrics.AddCounter(fmt.Sprintf("%s.response.%d", patclean, ww.Status()))
-			metrics.UpdateTimerSince(fmt.Sprintf("%s.latency", patclean), start)
-		}
-	})
+// ApplyStats is Stats with the default options
+func ApplyStats(h goji.Handler) goji.Handler {
+	return applyStats(h)
 }
 
 // ApplySubStats is a helper for using ApplyStats with nested muxes. It
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+func TestStatsMethodLabel(t *testing.T) {
+	h := Stats(StatsOptions{})(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}))
+	for _, method := range []string{"GET", "PROPFIND", "X-RANDOM-1", "X-RANDOM-2"} {
+		r, _ := http.NewRequest(method, "/", nil)
+		h.ServeHTTPC(context.Background(), httptest.NewRecorder(), r)
+	}
+	for key, expected := range map[string]int64{
+		`http_requests_total{code="200",method="GET",route="unmatched"}`:   1,
+		`http_requests_total{code="200",method="OTHER",route="unmatched"}`: 3,
+	} {
+		c, ok := gometrics.DefaultRegistry.Get(key).(gometrics.Counter)
+		if !ok || c.Count() != expected {
+			t.Error(key, "Expected:", expected, "Got:", c)
+		}
+	}
+	if gometrics.DefaultRegistry.Get(`http_requests_total{code="200",method="PROPFIND",route="unmatched"}`) != nil {
+		t.Error("Expected no series for an arbitrary method")
+	}
+}
@@ -8,18 +8,23 @@ import (
 	"golang.org/x/net/context"
 )
 
+// ApplyRecoverer is a goji middleware that recovers from panics, logs them and responds with a 500.
+// The panic is logged to the request's logger if ApplyLogger is in use, to l otherwise. The
+// request's logger is the one the panicking handler had, with the fields added after the
+// recoverer, e.g. the user by jwt.
 func ApplyRecoverer(l log.Logger) func(goji.Handler) goji.Handler {
 	return func(handler goji.Handler) goji.Handler {
 		fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-			reqID := GetReqID(ctx)
+			ctx = log.TrackContext(ctx)
 			defer func() {
 				if err := recover(); err != nil {
-					l.Error(
+					pl := log.LatestFromContext(ctx)
+					if pl == log.Discard {
+						// the logger of the handler has the route already, e.g. from the mux
+						pl = requestLogger(ctx, l, r).With("route", Route(ctx))
+					}
+					pl.Error(
 						"type", "Runtime Panic",
-						"req_id", reqID,
-						"uri", r.RequestURI,
-						"method", r.Method,
-						"remote", r.RemoteAddr,
 						"error_message", err,
 						"error_stack", debug.Stack())
 
@@ -31,4 +36,3 @@ func ApplyRecoverer(l log.Logger) func(goji.Handler) goji.Handler {
 		return goji.HandlerFunc(fn)
 	}
 }
-
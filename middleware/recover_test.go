@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hifx/bingo/infra/log"
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+// fieldsLogger records the fields of the events logged with Error
+type fieldsLogger struct {
+	log.Logger
+	fields map[string]interface{}
+	errors *[]map[string]interface{}
+}
+
+func (l fieldsLogger) With(keyvals ...interface{}) log.Logger {
+	fields := map[string]interface{}{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[keyvals[i].(string)] = keyvals[i+1]
+	}
+	return fieldsLogger{l.Logger, fields, l.errors}
+}
+
+func (l fieldsLogger) Error(keyvals ...interface{}) {
+	*l.errors = append(*l.errors, l.With(keyvals...).(fieldsLogger).fields)
+}
+
+func TestRecoverer(t *testing.T) {
+	var errors []map[string]interface{}
+	l := fieldsLogger{log.Discard, nil, &errors}
+	h := ApplyRecoverer(l)(ApplyLogger(l)(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		// e.g. the mux adding the route and jwt the user
+		ctx = log.NewContext(ctx, log.FromContext(ctx).With("route", "/users/:id", "user", "ada"))
+		log.FromContext(ctx).Info("msg", "about to panic")
+		panic("boom")
+	})))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/users/1?token=s3cr3t", nil)
+	h.ServeHTTPC(context.Background(), w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Error("Expected:", http.StatusInternalServerError, "Got:", w.Code)
+	}
+	if len(errors) != 1 {
+		t.Fatal("Expected the panic to be logged, Got:", errors)
+	}
+	if e := errors[0]; e["user"] != "ada" || e["route"] != "/users/:id" || e["uri"] != "/users/1" || e["error_message"] != "boom" {
+		t.Error("Expected the fields of the handler's logger, Got:", e)
+	}
+}
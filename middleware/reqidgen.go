@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// HostSequenceID generates IDs of the form "host.example.com/random-000001", where random
+// identifies the process and the number is a counter of the requests
+func HostSequenceID() string {
+	return fmt.Sprintf("%s-%06d", prefix, atomic.AddUint64(&reqid, 1))
+}
+
+// UUIDv4 generates random UUIDs, as per RFC 4122
+func UUIDv4() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+// UUIDv7 generates time-ordered UUIDs, as per RFC 9562: a millisecond timestamp followed by random bits
+func UUIDv7() string {
+	var u [16]byte
+	rand.Read(u[6:])
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ts[2:])
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates lexicographically sortable IDs, as per https://github.com/ulid/spec: a 48 bit
+// millisecond timestamp followed by 80 random bits, in 26 characters of Crockford base32
+func ULID() string {
+	var u [16]byte
+	rand.Read(u[6:])
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ts[2:])
+
+	// 128 bits in 26 characters of 5 bits, the first holding the 3 most significant bits
+	var b [26]byte
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	for i := 25; i >= 0; i-- {
+		b[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
@@ -4,18 +4,20 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
-	"sync/atomic"
 
+	"github.com/hifx/bingo/infra/log"
 	"goji.io"
 
 	"golang.org/x/net/context"
 )
 
 // Key to use when setting the request ID.
-const RequestIDKey = "reqID"
+const RequestIDKey = log.ReqIDKey
 
 var prefix string
 var reqid uint64
@@ -58,39 +60,140 @@ func init() {
 	prefix = fmt.Sprintf("%s/%s", hostname, b64[0:10])
 }
 
+// DefaultReqIDMaxLength is the maximum length of an incoming request ID accepted by default
+const DefaultReqIDMaxLength = 128
+
+// defaultReqIDCharset is the charset of the incoming request IDs accepted by default. Commas
+// are accepted for the IDs chained by upstream services.
+var defaultReqIDCharset = regexp.MustCompile(`^[A-Za-z0-9._:/+=@,-]+$`)
+
+// ReqIDOptions configures the ReqID middleware
+type ReqIDOptions struct {
+	// Generator generates the IDs of the requests. Defaults to HostSequenceID.
+	Generator func() string
+
+	// TrustIncoming uses the request IDs sent by clients, from any network unless TrustedNetworks
+	// is set. Incoming IDs are ignored otherwise.
+	TrustIncoming bool
+	// TrustedNetworks, if set, restricts TrustIncoming to clients in these networks, in CIDR
+	// notation, e.g. "10.0.0.0/8". ReqID panics if one is invalid.
+	TrustedNetworks []string
+	// Chain appends a trusted incoming ID to a generated one, as in "host/random-000001,given",
+	// instead of using the incoming ID as is.
+	Chain bool
+	// MaxLength is the maximum length of an incoming ID. Defaults to DefaultReqIDMaxLength.
+	MaxLength int
+	// Charset validates incoming IDs; those not matching are ignored. Defaults to letters, digits and ._:/+=@,-
+	Charset *regexp.Regexp
+
+	// Headers are the headers an incoming ID is read from, in order. Defaults to X-Request-Id and Request-Id.
+	Headers []string
+	// ResponseHeader is the header the ID is echoed in. Defaults to X-Request-Id; set it to "-" not to echo it.
+	ResponseHeader string
+}
+
+/*
+ReqID returns a middleware that injects a request ID into the context of each
+request, and echoes it in the response. The ID is generated by o.Generator,
+unless the request carries an ID that is trusted and valid as per o, e.g.
+
+	middleware.ReqID(middleware.ReqIDOptions{
+		Generator:       middleware.UUIDv7,
+		TrustIncoming:   true,
+		TrustedNetworks: []string{"10.0.0.0/8"},
+	})
+*/
+func ReqID(o ReqIDOptions) func(goji.Handler) goji.Handler {
+	if o.Generator == nil {
+		o.Generator = HostSequenceID
+	}
+	if o.MaxLength <= 0 {
+		o.MaxLength = DefaultReqIDMaxLength
+	}
+	if o.Charset == nil {
+		o.Charset = defaultReqIDCharset
+	}
+	if len(o.Headers) == 0 {
+		o.Headers = []string{"X-Request-Id", "Request-Id"}
+	}
+	if o.ResponseHeader == "" {
+		o.ResponseHeader = "X-Request-Id"
+	}
+	networks := make([]*net.IPNet, len(o.TrustedNetworks))
+	for i, cidr := range o.TrustedNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("middleware: invalid trusted network %q: %s", cidr, err))
+		}
+		networks[i] = n
+	}
+
+	incoming := func(r *http.Request) string {
+		if !o.TrustIncoming || (len(networks) > 0 && !inNetworks(r.RemoteAddr, networks)) {
+			return ""
+		}
+		for _, h := range o.Headers {
+			if given := r.Header.Get(h); given != "" {
+				if len(given) > o.MaxLength || !o.Charset.MatchString(given) {
+					return ""
+				}
+				return given
+			}
+		}
+		return ""
+	}
+
+	return func(h goji.Handler) goji.Handler {
+		return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			rid := incoming(r)
+			if rid == "" {
+				rid = o.Generator()
+			} else if o.Chain {
+				rid = o.Generator() + "," + rid
+			}
+			ctx = context.WithValue(ctx, RequestIDKey, rid)
+			if o.ResponseHeader != "-" {
+				w.Header().Set(o.ResponseHeader, rid)
+			}
+			h.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
+
+// inNetworks reports whether the host of addr is in one of the networks
+func inNetworks(addr string, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var applyReqID = ReqID(ReqIDOptions{})
+
 /*
 ApplyReqID is a middleware that injects a request ID into the context of each
 request. A request ID is a string of the form "host.example.com/random-0001",
 where "random" is a base62 random string that uniquely identifies this go
 process, and where the last number is an atomically incremented request
-counter.
+counter. IDs sent by clients are ignored, as they may be spoofed; use ReqID
+with TrustedNetworks to keep the IDs of upstream services.
 */
 func ApplyReqID(h goji.Handler) goji.Handler {
-	return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		given := r.Header.Get("X-Request-Id")
-		if given == "" {
-			given = r.Header.Get("Request-Id")
-		}
-
-		rid := fmt.Sprintf("%s-%06d", prefix, atomic.AddUint64(&reqid, 1))
-		if given != "" {
-			rid += "," + given
-		}
-		ctx = context.WithValue(ctx, RequestIDKey, rid)
-		w.Header().Set("X-Request-Id", rid)
-		h.ServeHTTPC(ctx, w, r)
-	})
+	return applyReqID(h)
 }
 
 // GetReqID returns a request ID from the given context if one is present.
 // Returns the empty string if a request ID cannot be found.
 func GetReqID(ctx context.Context) string {
-	if ctx == nil {
-		return ""
-	}
-	reqID, ok := ctx.Value(RequestIDKey).(string)
-	if !ok {
-		return ""
-	}
-	return reqID
+	return log.ReqID(ctx)
 }
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+func TestReqID(t *testing.T) {
+	o := ReqIDOptions{
+		Generator:       func() string { return "gen" },
+		TrustIncoming:   true,
+		TrustedNetworks: []string{"10.0.0.0/8"},
+	}
+	chained := o
+	chained.Chain = true
+
+	for _, c := range []struct {
+		o        ReqIDOptions
+		remote   string
+		given    string
+		expected string
+	}{
+		{o, "10.1.2.3:1234", "abc-123", "abc-123"},
+		{o, "192.168.1.1:1234", "abc-123", "gen"},
+		{o, "10.1.2.3:1234", "bad id\nlevel=crit", "gen"},
+		{o, "10.1.2.3:1234", strings.Repeat("a", DefaultReqIDMaxLength+1), "gen"},
+		{chained, "10.1.2.3:1234", "abc-123", "gen,abc-123"},
+		{ReqIDOptions{Generator: func() string { return "gen" }}, "10.1.2.3:1234", "abc-123", "gen"},
+	} {
+		var got string
+		h := ReqID(c.o)(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			got = GetReqID(ctx)
+		}))
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		req.Header.Set("X-Request-Id", c.given)
+		w := httptest.NewRecorder()
+		h.ServeHTTPC(context.Background(), w, req)
+		if got != c.expected || w.Header().Get("X-Request-Id") != c.expected {
+			t.Error(c.remote, c.given, "Expected:", c.expected, "Got:", got, w.Header().Get("X-Request-Id"))
+		}
+	}
+}
+
+func TestReqIDHops(t *testing.T) {
+	hop := func(gen, given string) string {
+		var got string
+		h := ReqID(ReqIDOptions{
+			Generator:       func() string { return gen },
+			TrustIncoming:   true,
+			TrustedNetworks: []string{"10.0.0.0/8"},
+			Chain:           true,
+		})(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			got = GetReqID(ctx)
+		}))
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.1.2.3:1234"
+		req.Header.Set("X-Request-Id", given)
+		h.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+		return got
+	}
+	// the ID chained by the first service is kept by the second
+	if got := hop("b/2", hop("a/1", "client-1")); got != "b/2,a/1,client-1" {
+		t.Error("Expected: b/2,a/1,client-1 Got:", got)
+	}
+}
+
+func TestApplyReqIDIgnoresIncoming(t *testing.T) {
+	var got string
+	h := ApplyReqID(goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = GetReqID(ctx)
+	}))
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Request-Id", "spoofed")
+	h.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+	if got == "" || strings.Contains(got, "spoofed") {
+		t.Error("Expected a generated ID, Got:", got)
+	}
+}
+
+func TestReqIDGenerators(t *testing.T) {
+	for name, c := range map[string]struct {
+		gen func() string
+		re  *regexp.Regexp
+	}{
+		"uuidv4": {UUIDv4, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		"uuidv7": {UUIDv7, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		"ulid":   {ULID, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+	} {
+		a, b := c.gen(), c.gen()
+		if !c.re.MatchString(a) || a == b {
+			t.Error(name, "Unexpected IDs:", a, b)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hifx/bingo/infra/log"
+	"github.com/hifx/bingo/infra/trace"
+	"github.com/hifx/bingo/middleware/mutil"
+	"goji.io"
+	"golang.org/x/net/context"
+)
+
+// ApplyTrace is a goji middleware that starts a server span for every request, continuing the trace
+// of the caller if the request has a W3C traceparent header. The span is named after the method
+// and the route matched, e.g. "GET /users/:id". The trace_id is added to the request's logger if
+// ApplyLogger is in use before it.
+func ApplyTrace(h goji.Handler) goji.Handler {
+	return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if sc, ok := trace.Extract(r.Header); ok {
+			ctx = trace.WithRemoteParent(ctx, sc)
+		}
+		ctx, span := trace.StartSpanKind(ctx, r.Method, trace.KindServer)
+		defer span.Finish()
+		if l := log.FromContext(ctx); l != log.Discard {
+			ctx = log.NewContext(ctx, l.With("trace_id", span.Context().TraceID.String()))
+		}
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		if id := GetReqID(ctx); id != "" {
+			span.SetAttribute("req_id", id)
+		}
+		ctx, patterns := withPatterns(ctx)
+
+		ww := mutil.WrapWriter(w)
+		h.ServeHTTPC(ctx, ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if route := joinPatterns(*patterns); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttribute("http.route", route)
+		}
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if status >= http.StatusInternalServerError {
+			span.SetError(httpStatusError(status))
+		}
+	})
+}
+
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return strconv.Itoa(int(e)) + " " + http.StatusText(int(e))
+}
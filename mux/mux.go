@@ -5,14 +5,26 @@ It adds a predefined list of middlewares to muxes and sub-muxes that would be cr
 
 e.g. usage
 
-	acslog := log.NewJSONLogger(conf.Log.Access)
-	errlog := log.NewJSONLogger(conf.Log.Err)
+	acslog, err := log.NewJSONLogger(conf.Log.Access)
+	if err != nil {
+		return err
+	}
+	errlog, err := log.NewJSONLogger(conf.Log.Err, log.FileOptions{MaxSize: 100 << 20, MaxBackups: 5, Compress: true})
+	if err != nil {
+		return err
+	}
 	mux.Init(acslog, errlog)
 
+To restrict cross-origin requests, pass the CORS options to Init
+
+	mux.Init(acslog, errlog, middleware.CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
 To set custom middleware like logger, 404, metrics and 404 handlers to all muxes, use
 
-	acslog := log.NewJSONLogger(conf.Log.Access)
-	errlog := log.NewJSONLogger(conf.Log.Err)
 	mux.SetLogs(acslog, errlog)
 
 	mux.SetSubMware(
@@ -20,10 +32,16 @@ To set custom middleware like logger, 404, metrics and 404 handlers to all muxes
 			middleware.Apply404)
 
 	mux.SetMware(
+		middleware.ApplyReqID,
+		middleware.ApplyLogger(errlog),
 		middleware.ApplyLog(acsslog),
 		middleware.Apply404,
-		middleware.ApplyStats,
-		middleware.ApplyReqID)
+		middleware.ApplyStats)
+
+Handlers get a logger carrying the request's req_id, method, uri, remote, route and user
+from the context
+
+	log.FromContext(ctx).Info("msg", "order placed", "order_id", id)
 
 */
 package mux
@@ -31,6 +49,7 @@ package mux
 import (
 	"net/http"
 
+	"github.com/hifx/bingo"
 	"github.com/hifx/bingo/infra/log"
 	"github.com/hifx/bingo/middleware"
 	"github.com/hifx/errgo"
@@ -46,98 +65,144 @@ var acslog, errlog log.Logger
 //Mux is a wrapper over Goji's mux
 type Mux struct {
 	*goji.Mux
+	routes *routes
 }
 
 // Get dispatches to the given handler when the pattern matches and the HTTP
 // method is GET.
 func (m *Mux) Get(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "GET")
 	m.HandleFuncC(pat.Get(pattern), wrap(h))
 }
 
 // Post dispatches to the given handler when the pattern matches and the HTTP
 // method is POST.
 func (m *Mux) Post(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "POST")
 	m.HandleFuncC(pat.Post(pattern), wrap(h))
 }
 
 // Put dispatches to the given handler when the pattern matches and the HTTP
 // method is PUT.
 func (m *Mux) Put(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "PUT")
 	m.HandleFuncC(pat.Put(pattern), wrap(h))
 }
 
 // Patch dispatches to the given handler when the pattern matches and the HTTP
 // method is PATCH.
 func (m *Mux) Patch(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "PATCH")
 	m.HandleFuncC(pat.Patch(pattern), wrap(h))
 }
 
 // Delete dispatches to the given handler when the pattern matches and the HTTP
 // method is DELETE.
 func (m *Mux) Delete(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "DELETE")
 	m.HandleFuncC(pat.Delete(pattern), wrap(h))
 }
 
 // Options dispatches to the given handler when the pattern matches and the HTTP
 // method is OPTIONS.
 func (m *Mux) Options(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "OPTIONS")
 	m.HandleFuncC(pat.Options(pattern), wrap(h))
 }
 
 // Head dispatches to the given handler when the pattern matches and the HTTP
 // method is HEAD.
 func (m *Mux) Head(pattern string, h func(context.Context, http.ResponseWriter, *http.Request) error) {
+	m.routes.register(pattern, "HEAD")
 	m.HandleFuncC(pat.Head(pattern), wrap(h))
 }
 
+// Handle dispatches to h when p matches. The routes of a sub-mux mounted this way, e.g. on
+// pat.New("/api/*"), are resolved under p by AllowedMethods.
+func (m *Mux) Handle(p goji.Pattern, h http.Handler) {
+	if sub, ok := h.(*Mux); ok {
+		m.routes.mount(p, sub)
+	}
+	m.Mux.Handle(p, h)
+}
+
+// HandleC is Handle for goji handlers
+func (m *Mux) HandleC(p goji.Pattern, h goji.Handler) {
+	if sub, ok := h.(*Mux); ok {
+		m.routes.mount(p, sub)
+	}
+	m.Mux.HandleC(p, h)
+}
+
+// errInternal is rendered for errors that don't carry any HTTP information
+var errInternal = bingo.NewHTTPError(http.StatusInternalServerError, "internal_error", "")
+
 //wrap helps make application handlers  satisfy goji's type HandlerFunc.
-//Any error returned by bingo's app handler's would be logged to the error log
-//TODO: Log "req_id", "method", "uri", "remote", "err", "stack"
+//The request's logger, with the matched route added, is passed to the
+//handler in the context. Any error returned by bingo's app handler's would be logged to it,
+//or to the error log if middleware.ApplyLogger isn't in use.
+//Errors satisfying bingo.HTTPError are rendered as per the request's Accept header; any
+//other error results in a 500 without exposing the error to the client.
 func wrap(h func(context.Context, http.ResponseWriter, *http.Request) error) func(context.Context, http.ResponseWriter, *http.Request) {
 	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		l := middleware.Logger(ctx, errlog, r).With("route", middleware.Route(ctx))
+		ctx = log.NewContext(ctx, l)
+
 		err := h(ctx, w, r)
-		if err != nil {
-			reqid := middleware.GetReqID(ctx)
-			switch e := err.(type) {
-			case *errgo.Err:
-				errlog.Error(
-					"req_id", reqid,
-					"uri", r.RequestURI,
-					"method", r.Method,
-					"remote", r.RemoteAddr,
-					"error", e.Error(),
-					"stack", e.Stack(),
-				)
-				w.Header().Set("Content-Type", e.ContentType())
-				w.Header().Set("X-Content-Type-Options", "nosniff")
-				w.WriteHeader(code)
-				w.Write([]byte(e.Message()))
-			default:
-				errlog.Error(
-					"req_id", reqid,
-					"uri", r.RequestURI,
-					"method", r.Method,
-					"remote", r.RemoteAddr,
-					"error", err.Error(),
-				)
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if err == nil {
+			return
+		}
+		keyvals := []interface{}{"error", err.Error()}
+		switch e := err.(type) {
+		case bingo.HTTPError:
+			keyvals = append(keyvals, "status", e.StatusCode(), "code", e.Code())
+			if c, ok := e.(causer); ok && c.Cause() != nil {
+				keyvals = append(keyvals, "cause", c.Cause().Error())
+			}
+			if e.StatusCode() < http.StatusInternalServerError {
+				l.Warn(keyvals...)
+			} else {
+				if s, ok := e.(stacker); ok && s.Stack() != "" {
+					keyvals = append(keyvals, "stack", s.Stack())
+				}
+				l.Error(keyvals...)
 			}
+			bingo.WriteError(w, r, e)
+		case *errgo.Err:
+			keyvals = append(keyvals, "stack", e.Stack())
+			l.Error(keyvals...)
+			w.Header().Set("Content-Type", e.ContentType())
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(e.Message()))
+		default:
+			l.Error(keyvals...)
+			bingo.WriteError(w, r, errInternal)
 		}
 	}
 	return fn
 }
 
+type causer interface {
+	Cause() error
+}
+
+type stacker interface {
+	Stack() string
+}
+
 /*
 New is a wrapper over goji.NewMux(). It adds
 the pre-defined list of middlewares to the mux
 */
 func New() *Mux {
-	m := goji.NewMux()
+	m := &Mux{Mux: goji.NewMux(), routes: newRoutes()}
+	m.UseC(m.withMux)
 	for _, mware := range mlist {
 		m.UseC(mware)
 	}
 
-	return &Mux{m}
+	return m
 }
 
 /*
@@ -145,11 +210,12 @@ Sub is a wrapper over goji.SubMux(). It adds
 the pre-defined list of middlewares to the submux
 */
 func Sub() *Mux {
-	m := goji.SubMux()
+	m := &Mux{Mux: goji.SubMux(), routes: newRoutes()}
+	m.UseC(m.withMux)
 	for _, mware := range submlist {
 		m.UseC(mware)
 	}
-	return &Mux{m}
+	return m
 }
 
 // SetMware sets the middlewares to be used for all muxes
@@ -163,11 +229,22 @@ func SetSubMware(m ...func(goji.Handler) goji.Handler) {
 }
 
 //Init initializes the mux package. It initializes the middlewares to be used by Muxes & SubMuxes
-//and sets the loggers. An application can overwrite the middlewares by calling SetMware & SetSubMware
-func Init(acslog, errlog log.Logger) {
+//and sets the loggers. An application can overwrite the middlewares by calling SetMware & SetSubMware.
+//An optional CORSOptions configures the CORS middleware; all origins are allowed if it is omitted.
+//The methods allowed for a resource default to the ones registered on the muxes.
+func Init(acslog, errlog log.Logger, cors ...middleware.CORSOptions) {
+	var o middleware.CORSOptions
+	if len(cors) > 0 {
+		o = cors[0]
+	}
+	if o.MethodsFunc == nil {
+		o.MethodsFunc = AllowedMethods
+	}
 	SetMware(
-		middleware.CrossDomainRequestAllower,
+		middleware.CORS(o),
 		middleware.ApplyReqID,
+		middleware.ApplyLogger(errlog),
+		middleware.ApplyTrace,
 		middleware.ApplyRecoverer(errlog),
 		middleware.ApplyLog(acslog),
 		middleware.Apply404,
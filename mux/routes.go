@@ -0,0 +1,112 @@
+package mux
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"goji.io"
+	"goji.io/pat"
+	"golang.org/x/net/context"
+)
+
+// route is a pattern registered through the Mux helpers and the methods it handles
+type route struct {
+	pattern *pat.Pattern
+	methods map[string]struct{}
+}
+
+// mount is a sub-mux mounted on a pattern of its parent, e.g. "/api/*"
+type mount struct {
+	pattern goji.Pattern
+	sub     *Mux
+}
+
+// routes keeps track of the routes registered on a mux and of the sub-muxes mounted on it, in
+// the order they were registered
+type routes struct {
+	sync.RWMutex
+	index  map[string]*route
+	list   []*route
+	mounts []mount
+}
+
+func newRoutes() *routes {
+	return &routes{index: map[string]*route{}}
+}
+
+func (rs *routes) register(pattern, method string) {
+	rs.Lock()
+	defer rs.Unlock()
+	rt, ok := rs.index[pattern]
+	if !ok {
+		rt = &route{pattern: pat.New(pattern), methods: map[string]struct{}{}}
+		rs.index[pattern] = rt
+		rs.list = append(rs.list, rt)
+	}
+	rt.methods[method] = struct{}{}
+	if method == "GET" {
+		// pat.Get matches HEAD requests as well
+		rt.methods["HEAD"] = struct{}{}
+	}
+}
+
+func (rs *routes) mount(p goji.Pattern, sub *Mux) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.mounts = append(rs.mounts, mount{pattern: p, sub: sub})
+}
+
+// methods adds the methods of the routes matching r to set. The routes of the sub-muxes are
+// matched against the path left by the pattern they are mounted on.
+func (rs *routes) methods(ctx context.Context, r *http.Request, set map[string]struct{}) {
+	rs.RLock()
+	defer rs.RUnlock()
+	for _, rt := range rs.list {
+		if rt.pattern.Match(ctx, r) == nil {
+			continue
+		}
+		for m := range rt.methods {
+			set[m] = struct{}{}
+		}
+	}
+	for _, m := range rs.mounts {
+		if mctx := m.pattern.Match(ctx, r); mctx != nil {
+			m.sub.routes.methods(mctx, r, set)
+		}
+	}
+}
+
+type ctxKey int
+
+const muxKey ctxKey = 0
+
+// withMux stores m in the context, for AllowedMethods to resolve the routes of the request
+func (m *Mux) withMux(h goji.Handler) goji.Handler {
+	return goji.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTPC(context.WithValue(ctx, muxKey, m), w, r)
+	})
+}
+
+/*
+AllowedMethods returns the HTTP methods registered via Get, Post, Put etc. for
+the path requested, on the mux serving the request and on the sub-muxes mounted
+on it via Handle or HandleC. It returns nil if no route matches the path.
+*/
+func AllowedMethods(ctx context.Context, r *http.Request) []string {
+	m, ok := ctx.Value(muxKey).(*Mux)
+	if !ok {
+		return nil
+	}
+	set := map[string]struct{}{}
+	m.routes.methods(ctx, r, set)
+	if len(set) == 0 {
+		return nil
+	}
+	methods := make([]string, 0, len(set))
+	for m := range set {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
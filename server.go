@@ -0,0 +1,286 @@
+package bingo
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultDrainTimeout is the time given to in-flight requests to complete on shutdown
+	DefaultDrainTimeout = 10 * time.Second
+	// DefaultCloserTimeout is the time given to each closer to complete on shutdown
+	DefaultCloserTimeout = 5 * time.Second
+)
+
+// listener describes an address the server listens on
+type listener struct {
+	network, addr     string
+	certFile, keyFile string
+}
+
+/*
+Server is an HTTP server with a managed lifecycle. It owns its mux, can listen on
+several addresses at once and shuts down gracefully on SIGTERM/SIGINT or when Stop is
+called: it stops accepting connections, waits for in-flight requests to drain, then
+runs the registered closers in reverse order of registration.
+
+e.g. usage
+
+	h := bingo.Wrap(m).AddCloser(db)
+	s := bingo.NewServer()
+	s.Handle("/", h)
+	s.ListenHTTP(":8080").ListenUnix("/var/run/app.sock")
+	if err := s.Run(); err != nil {
+		bingo.PrintError(err)
+	}
+*/
+type Server struct {
+	// DrainTimeout is the time given to in-flight requests to complete on shutdown.
+	// Connections still active afterwards are closed. Zero or less waits for them without limit.
+	DrainTimeout time.Duration
+	// CloserTimeout is the time given to each closer to complete
+	CloserTimeout time.Duration
+	// Signals are the signals that trigger a shutdown. Defaults to SIGTERM and SIGINT.
+	Signals []os.Signal
+
+	mux       *http.ServeMux
+	listeners []listener
+	closers   []io.Closer
+	onStart   []func(*Server)
+	onStop    []func(*Server)
+
+	mu    sync.Mutex
+	addrs []net.Addr
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// NewServer returns a Server with the default timeouts
+func NewServer() *Server {
+	return &Server{
+		DrainTimeout:  DefaultDrainTimeout,
+		CloserTimeout: DefaultCloserTimeout,
+		Signals:       []os.Signal{syscall.SIGTERM, syscall.SIGINT},
+		mux:           http.NewServeMux(),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Handle registers the handler for the given pattern on the server's mux. If h is a *Handler,
+// it is closed on shutdown.
+func (s *Server) Handle(pattern string, h http.Handler) *Server {
+	s.mux.Handle(pattern, h)
+	if bh, ok := h.(*Handler); ok {
+		s.closers = append(s.closers, bh)
+	}
+	return s
+}
+
+// ListenHTTP makes the server listen for HTTP requests on the TCP address addr
+func (s *Server) ListenHTTP(addr string) *Server {
+	s.listeners = append(s.listeners, listener{network: "tcp", addr: addr})
+	return s
+}
+
+// ListenHTTPS makes the server listen for HTTPS requests on the TCP address addr
+func (s *Server) ListenHTTPS(addr, certFile, keyFile string) *Server {
+	s.listeners = append(s.listeners, listener{network: "tcp", addr: addr, certFile: certFile, keyFile: keyFile})
+	return s
+}
+
+// ListenUnix makes the server listen for HTTP requests on the unix socket at path.
+// A stale socket file at path is removed.
+func (s *Server) ListenUnix(path string) *Server {
+	s.listeners = append(s.listeners, listener{network: "unix", addr: path})
+	return s
+}
+
+// AddCloser registers a closer to be run on shutdown. Closers are run in reverse order of registration.
+func (s *Server) AddCloser(c io.Closer) *Server {
+	s.closers = append(s.closers, c)
+	return s
+}
+
+// OnStart registers a hook called once all listeners are bound, before serving requests
+func (s *Server) OnStart(f func(*Server)) *Server {
+	s.onStart = append(s.onStart, f)
+	return s
+}
+
+// OnStop registers a hook called after the server has shut down and all closers have run
+func (s *Server) OnStop(f func(*Server)) *Server {
+	s.onStop = append(s.onStop, f)
+	return s
+}
+
+// Addrs returns the addresses the server is listening on. It is useful from an OnStart hook,
+// e.g. in tests listening on ":0".
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]net.Addr(nil), s.addrs...)
+}
+
+// Stop triggers the shutdown of a running server. It does not wait for the shutdown to complete.
+func (s *Server) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// Run starts the server and blocks until it is shut down. The error returned holds
+// the errors of the listeners and of all the closers that failed.
+func (s *Server) Run() error {
+	if len(s.listeners) == 0 {
+		return fmt.Errorf("bingo: no address to listen on")
+	}
+
+	lns := make([]net.Listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		ln, err := l.listen()
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+		lns = append(lns, ln)
+		s.mu.Lock()
+		s.addrs = append(s.addrs, ln.Addr())
+		s.mu.Unlock()
+	}
+
+	for _, f := range s.onStart {
+		f(s)
+	}
+
+	srv := &http.Server{Handler: s.mux}
+	serveErrs := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				serveErrs <- fmt.Errorf("bingo: serving on %s: %s", ln.Addr(), err)
+			}
+		}(ln)
+	}
+
+	sig := make(chan os.Signal, 1)
+	if len(s.Signals) > 0 {
+		signal.Notify(sig, s.Signals...)
+		defer signal.Stop(sig)
+	}
+
+	var errs Errors
+	select {
+	case <-sig:
+	case <-s.stop:
+	case err := <-serveErrs:
+		errs = append(errs, err)
+	}
+
+	ctx := context.Background()
+	if s.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.DrainTimeout)
+		defer cancel()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		// the drain period is over, drop the remaining connections
+		srv.Close()
+	}
+
+	closers := make([]io.Closer, len(s.closers))
+	for i, c := range s.closers {
+		closers[len(closers)-1-i] = c
+	}
+	if err := closeAll(closers, s.CloserTimeout); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+
+	for _, f := range s.onStop {
+		f(s)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (l listener) listen() (net.Listener, error) {
+	if l.network == "unix" {
+		if err := os.Remove(l.addr); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("bingo: unable to remove stale socket %s: %s", l.addr, err)
+		}
+	}
+	ln, err := net.Listen(l.network, l.addr)
+	if err != nil {
+		return nil, fmt.Errorf("bingo: unable to listen on %s: %s", l.addr, err)
+	}
+	if l.certFile == "" {
+		return ln, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("bingo: unable to load certificate for %s: %s", l.addr, err)
+	}
+	return tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}), nil
+}
+
+// Errors is a list of errors that occurred together, e.g. while running the closers
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// closeAll runs the closers in order, giving each at most timeout to complete.
+// All closers are run; the errors are returned as Errors.
+func closeAll(closers []io.Closer, timeout time.Duration) error {
+	var errs Errors
+	for _, c := range closers {
+		err := closeWithTimeout(c, timeout)
+		if nested, ok := err.(Errors); ok {
+			errs = append(errs, nested...)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func closeWithTimeout(c io.Closer, timeout time.Duration) error {
+	if timeout <= 0 {
+		return c.Close()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("bingo: closing %T timed out after %s", c, timeout)
+	}
+}
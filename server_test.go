@@ -0,0 +1,112 @@
+package bingo
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestServer(t *testing.T) {
+	var order []string
+	closer := func(name string, err error) closerFunc {
+		return func() error {
+			order = append(order, name)
+			return err
+		}
+	}
+	errA, errC := errors.New("a failed"), errors.New("c failed")
+
+	h := Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})).AddCloser(closer("a", errA)).AddCloser(closer("b", nil))
+
+	var body string
+	stopped := false
+	s := NewServer()
+	s.Signals = nil
+	s.Handle("/", h).
+		AddCloser(closer("c", errC)).
+		ListenHTTP("127.0.0.1:0").
+		OnStart(func(s *Server) {
+			go func() {
+				defer s.Stop()
+				resp, err := http.Get("http://" + s.Addrs()[0].String() + "/")
+				if err != nil {
+					t.Error("Unexpected error:", err)
+					return
+				}
+				defer resp.Body.Close()
+				b, _ := ioutil.ReadAll(resp.Body)
+				body = string(b)
+			}()
+		}).
+		OnStop(func(s *Server) { stopped = true })
+
+	done := make(chan error)
+	go func() { done <- s.Run() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+
+	if body != "ok" {
+		t.Error("Body: Expected:", "ok", "Got:", body)
+	}
+	if !stopped {
+		t.Error("Stop hook not called")
+	}
+	// the closers of the server run in reverse order, those of the handler in order
+	if expected := "c a b"; len(order) != 3 || order[0]+" "+order[1]+" "+order[2] != expected {
+		t.Error("Close order: Expected:", expected, "Got:", order)
+	}
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 || errs[0] != errC || errs[1] != errA {
+		t.Error("Error: Expected:", Errors{errC, errA}, "Got:", err)
+	}
+}
+
+func TestServerDrainWithoutLimit(t *testing.T) {
+	s := NewServer()
+	s.Signals = nil
+	s.DrainTimeout = 0
+	bodies := make(chan string, 1)
+	s.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Stop()
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})).
+		ListenHTTP("127.0.0.1:0").
+		OnStart(func(s *Server) {
+			go func() {
+				defer close(bodies)
+				resp, err := http.Get("http://" + s.Addrs()[0].String() + "/")
+				if err != nil {
+					t.Error("Unexpected error:", err)
+					return
+				}
+				defer resp.Body.Close()
+				b, _ := ioutil.ReadAll(resp.Body)
+				bodies <- string(b)
+			}()
+		})
+
+	done := make(chan error)
+	go func() { done <- s.Run() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop")
+	}
+	// a zero timeout waits for the in-flight request rather than dropping it
+	if body := <-bodies; body != "ok" {
+		t.Error("Body: Expected:", "ok", "Got:", body)
+	}
+}
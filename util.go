@@ -3,12 +3,12 @@ package bingo
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/hifx/banner"
 	"github.com/hifx/bingo/infra/log"
-	"github.com/hifx/graceful"
 	"goji.io/pat"
 	"golang.org/x/net/context"
 )
@@ -34,10 +34,18 @@ func PrintError(a ...interface{}) {
 	hd.Println("----------------------------------")
 }
 
-//Run gracefully starts the http server
+//Run gracefully starts the http server. It blocks until the server receives SIGTERM or SIGINT,
+//waits up to timeout, or without limit if it is 0, for in-flight requests to complete and closes h if it is a *Handler.
+//It exits the process with status 1 if the server fails, e.g. to listen on addr.
+//Use Server for more control over the lifecycle.
 func Run(addr string, timeout time.Duration, h http.Handler) {
-	http.Handle("/", h)
-	graceful.Run(addr, timeout, http.DefaultServeMux)
+	s := NewServer()
+	s.DrainTimeout = timeout
+	s.Handle("/", h).ListenHTTP(addr)
+	if err := s.Run(); err != nil {
+		PrintError(err)
+		os.Exit(1)
+	}
 }
 
 //BoundParam returns the bound parameter with the given name. Wraps around goji's pat.Param